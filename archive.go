@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the manifest in an archive directory, with a snapshot per line.
+const manifestName = "manifest.jsonl"
+
+// A response that was archived, as listed in the manifest. Responses with the
+// same content share a file, which is named by the date it was first fetched
+// and the SHA-256 of the content, such as "2018-09-14_3a7bd3e2....gz".
+type snapshot struct {
+	SHA256      string    `json:"sha256"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Size        int64     `json:"size"`
+	File        string    `json:"file"`
+}
+
+// A directory of gzipped responses and their manifest. It is safe for
+// concurrent use, as meeting pages are fetched by several workers at once.
+type archive struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]string // File of each SHA-256, once the manifest is read.
+}
+
+func newArchive(dir string) *archive {
+	return &archive{dir: dir}
+}
+
+// Returns the snapshots in the manifest, oldest first. An archive without a
+// manifest has no snapshots.
+func (a *archive) snapshots() ([]snapshot, error) {
+	file, err := os.Open(filepath.Join(a.dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var snaps []snapshot
+
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		var s snapshot
+
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", manifestName, line, err)
+		}
+
+		snaps = append(snaps, s)
+	}
+
+	return snaps, scanner.Err()
+}
+
+// Replace the manifest with snaps.
+func (a *archive) writeManifest(snaps []snapshot) error {
+	file, err := ioutil.TempFile(a.dir, manifestName+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+
+	for _, s := range snaps {
+		if err := enc.Encode(s); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(a.dir, manifestName))
+}
+
+// A response body that is being written to the archive as it is read.
+type archiveWriter struct {
+	archive     *archive
+	url         string
+	contentType string
+
+	file *os.File
+	gz   *gzip.Writer
+	hash hash.Hash
+	size int64
+}
+
+// Start archiving a response from url, which is written to a temporary file
+// until it is complete.
+func (a *archive) create(url, contentType string) (*archiveWriter, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(a.dir, "incoming_*.gz")
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveWriter{
+		archive:     a,
+		url:         url,
+		contentType: contentType,
+		file:        file,
+		gz:          gzip.NewWriter(file),
+		hash:        sha256.New(),
+	}, nil
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	w.size += int64(len(p))
+
+	return w.gz.Write(p)
+}
+
+// Remove the temporary file of a response that was not read completely.
+func (w *archiveWriter) discard() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Move the response into place, unless its content was archived before, and
+// add it to the manifest.
+func (w *archiveWriter) commit() (snapshot, error) {
+	defer os.Remove(w.file.Name())
+
+	s := snapshot{
+		SHA256:      hex.EncodeToString(w.hash.Sum(nil)),
+		URL:         w.url,
+		ContentType: w.contentType,
+		FetchedAt:   time.Now().UTC().Truncate(time.Second),
+		Size:        w.size,
+	}
+
+	if err := w.gz.Close(); err != nil {
+		w.file.Close()
+		return s, err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return s, err
+	}
+
+	a := w.archive
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.files == nil {
+		snaps, err := a.snapshots()
+		if err != nil {
+			return s, err
+		}
+
+		a.files = map[string]string{}
+
+		for _, snap := range snaps {
+			a.files[snap.SHA256] = snap.File
+		}
+	}
+
+	s.File = a.files[s.SHA256]
+
+	if s.File == "" {
+		s.File = fmt.Sprintf("%s_%s.gz", s.FetchedAt.Format("2006-01-02"), s.SHA256)
+
+		if err := os.Rename(w.file.Name(), filepath.Join(a.dir, s.File)); err != nil {
+			return s, err
+		}
+
+		a.files[s.SHA256] = s.File
+	}
+
+	manifest, err := os.OpenFile(filepath.Join(a.dir, manifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return s, err
+	}
+
+	if err := json.NewEncoder(manifest).Encode(s); err != nil {
+		manifest.Close()
+		return s, err
+	}
+
+	return s, manifest.Close()
+}
+
+// Returns the content of a snapshot.
+func (a *archive) open(s snapshot) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(a.dir, s.File))
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", s.File, err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+// Archive the content of r, which was fetched from url. An error while
+// archiving is logged, as it does not affect the response.
+func (a *archive) store(url, contentType string, r io.Reader) {
+	w, err := a.create(url, contentType)
+	if err != nil {
+		log.Printf("could not archive %s: %v\n", url, err)
+		return
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.discard()
+		log.Printf("could not archive %s: %v\n", url, err)
+		return
+	}
+
+	if _, err := w.commit(); err != nil {
+		log.Printf("could not archive %s: %v\n", url, err)
+	}
+}
+
+// Replace the body of a response from url, so that it is archived once it is
+// read completely.
+func (a *archive) wrap(url string, res *http.Response) {
+	w, err := a.create(url, res.Header.Get("Content-Type"))
+	if err != nil {
+		log.Printf("could not archive %s: %v\n", url, err)
+		return
+	}
+
+	res.Body = &archivedBody{ReadCloser: res.Body, w: w}
+}
+
+// A fetcher that archives every successful response that is read completely.
+// Partial responses are archived by the source that completes them instead.
+type archivingFetcher struct {
+	Fetcher
+	archive *archive
+}
+
+func (f *archivingFetcher) Fetch(url string, header http.Header) (*http.Response, error) {
+	res, err := f.Fetcher.Fetch(url, header)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	f.archive.wrap(url, res)
+
+	return res, nil
+}
+
+type archivedBody struct {
+	io.ReadCloser
+	w   *archiveWriter
+	eof bool
+	err error // The first error writing to the archive.
+}
+
+func (b *archivedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if n > 0 && b.err == nil {
+		_, b.err = b.w.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+// Close the body, and archive it if it was read completely. An error while
+// archiving is logged, as it does not affect the response.
+func (b *archivedBody) Close() error {
+	err := b.ReadCloser.Close()
+
+	if !b.eof || b.err != nil {
+		b.w.discard()
+
+		if b.err != nil {
+			log.Printf("could not archive %s: %v\n", b.w.url, b.err)
+		}
+
+		return err
+	}
+
+	if _, aerr := b.w.commit(); aerr != nil {
+		log.Printf("could not archive %s: %v\n", b.w.url, aerr)
+	}
+
+	return err
+}
+
+// Returns the snapshot of url with a SHA-256 that starts with sum, or if sum
+// is empty, the last snapshot of url that was fetched before the given time.
+func findSnapshot(snaps []snapshot, url, sum string, before time.Time) (snapshot, error) {
+	var found []snapshot
+
+	for _, s := range snaps {
+		if s.URL != url {
+			continue
+		}
+
+		if sum != "" && strings.HasPrefix(s.SHA256, strings.ToLower(sum)) {
+			found = append(found, s)
+		}
+
+		if sum == "" && s.FetchedAt.Before(before) {
+			found = append(found, s)
+		}
+	}
+
+	if len(found) == 0 {
+		if sum != "" {
+			return snapshot{}, fmt.Errorf("no snapshot of %s with SHA-256 %s", url, sum)
+		}
+
+		return snapshot{}, fmt.Errorf("no snapshot of %s before %s", url, before.Format(time.RFC3339))
+	}
+
+	// A prefix may match different content, but not the same content that
+	// was fetched more than once.
+	for _, s := range found[1:] {
+		if s.SHA256 != found[0].SHA256 {
+			if sum != "" {
+				return snapshot{}, fmt.Errorf("SHA-256 %s matches more than one snapshot of %s", sum, url)
+			}
+
+			break
+		}
+	}
+
+	return found[len(found)-1], nil
+}
+
+// Returns the snapshots that are kept and removed by the retention policy.
+// Snapshots fetched before cutoff are removed, except for the last snapshot
+// of each URL, so there is always a version of a page to replay.
+func retainSnapshots(snaps []snapshot, cutoff time.Time) ([]snapshot, []snapshot) {
+	last := map[string]int{}
+
+	for i, s := range snaps {
+		if j, ok := last[s.URL]; !ok || !s.FetchedAt.Before(snaps[j].FetchedAt) {
+			last[s.URL] = i
+		}
+	}
+
+	var kept, removed []snapshot
+
+	for i, s := range snaps {
+		if s.FetchedAt.Before(cutoff) && last[s.URL] != i {
+			removed = append(removed, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+
+	return kept, removed
+}
+
+// Remove the snapshots fetched before cutoff from the manifest, see
+// retainSnapshots, and the files that no remaining snapshot refers to.
+func (a *archive) prune(cutoff time.Time, dryRun bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snaps, err := a.snapshots()
+	if err != nil {
+		return err
+	}
+
+	kept, removed := retainSnapshots(snaps, cutoff)
+
+	referenced := map[string]bool{}
+	for _, s := range kept {
+		referenced[s.File] = true
+	}
+
+	var files []string
+
+	for _, s := range removed {
+		if !referenced[s.File] {
+			referenced[s.File] = true
+			files = append(files, s.File)
+		}
+	}
+
+	log.Printf("removing %d of %d snapshots and %d files\n", len(removed), len(snaps), len(files))
+
+	if dryRun || len(removed) == 0 {
+		return nil
+	}
+
+	if err := a.writeManifest(kept); err != nil {
+		return err
+	}
+
+	// The manifest may refer to another file now.
+	a.files = nil
+
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(a.dir, file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
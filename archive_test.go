@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchivingFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fixtures := filepath.Join(dir, "fixtures")
+
+	if err := os.Mkdir(fixtures, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(fixtures, "example.com_register.xml"), []byte(registerXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newArchive(filepath.Join(dir, "archive"))
+	f := &archivingFetcher{&fileFetcher{fixtures}, a}
+
+	// Fetch the register completely twice, and once partially.
+	for _, n := range []int{-1, -1, 100} {
+		res, err := f.Fetch("http://example.com/register.xml", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n < 0 {
+			ioutil.ReadAll(res.Body)
+		} else {
+			res.Body.Read(make([]byte, n))
+		}
+
+		res.Body.Close()
+	}
+
+	snaps, err := a.snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snaps) != 2 || snaps[0].File != snaps[1].File {
+		t.Fatalf("expected 2 snapshots of the same file, got %+v", snaps)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(a.dir, "*.gz"))
+	if len(files) != 1 {
+		t.Errorf("expected 1 archived file, got %v", files)
+	}
+
+	src, err := a.open(snaps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer src.Close()
+
+	if body, _ := ioutil.ReadAll(src); string(body) != registerXML {
+		t.Errorf("expected the snapshot to be the register, got %d bytes", len(body))
+	}
+
+	// Pruning keeps the last snapshot of a URL, and with it the file.
+	if err := a.prune(time.Now().Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if snaps, _ := a.snapshots(); len(snaps) != 1 {
+		t.Errorf("expected 1 snapshot after pruning, got %d", len(snaps))
+	}
+
+	if _, err := os.Stat(files[0]); err != nil {
+		t.Errorf("expected %s to be kept, got %v", files[0], err)
+	}
+}
+
+func TestFindSnapshot(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2018, 9, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	snaps := []snapshot{
+		{SHA256: "aaa1", URL: "register", FetchedAt: day(1)},
+		{SHA256: "bbb1", URL: "register", FetchedAt: day(2)},
+		{SHA256: "aaa1", URL: "register", FetchedAt: day(3)},
+		{SHA256: "aaa2", URL: "register", FetchedAt: day(4)},
+		{SHA256: "ccc1", URL: "page", FetchedAt: day(5)},
+	}
+
+	tests := map[string]struct {
+		sum      string
+		before   time.Time
+		expected string
+	}{
+		"before date":       {"", day(3), "bbb1 on 2"},
+		"last":              {"", day(10), "aaa2 on 4"},
+		"sum":               {"BBB", time.Time{}, "bbb1 on 2"},
+		"sum fetched twice": {"aaa1", time.Time{}, "aaa1 on 3"},
+		"ambiguous sum":     {"aaa", time.Time{}, "error"},
+		"other url":         {"ccc", time.Time{}, "error"},
+		"too early":         {"", day(1), "error"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := "error"
+
+			if s, err := findSnapshot(snaps, "register", test.sum, test.before); err == nil {
+				output = s.SHA256 + " on " + s.FetchedAt.Format("2")
+			}
+
+			if output != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestRetainSnapshots(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2018, 9, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	snaps := []snapshot{
+		{URL: "register", FetchedAt: day(1)},
+		{URL: "page", FetchedAt: day(2)},
+		{URL: "register", FetchedAt: day(3)},
+		{URL: "register", FetchedAt: day(5)},
+	}
+
+	kept, removed := retainSnapshots(snaps, day(4))
+
+	if len(kept) != 2 || kept[0].URL != "page" || !kept[1].FetchedAt.Equal(day(5)) {
+		t.Errorf("expected the last page and register to be kept, got %+v", kept)
+	}
+
+	if len(removed) != 2 {
+		t.Errorf("expected 2 snapshots to be removed, got %+v", removed)
+	}
+}
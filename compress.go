@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Magic bytes of the compressed formats that sources are published in.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// Returns a reader of the XML in r, which is either plain XML or compressed
+// with gzip, zip or xz, as detected from its magic bytes. Closing the reader
+// does not close r.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	// An error means the source is shorter than the magic bytes, which is
+	// left to the decoder.
+	magic, _ := br.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		log.Printf("decompressing gzip\n")
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zipMagic):
+		log.Printf("decompressing zip\n")
+		return unzip(br)
+	case bytes.HasPrefix(magic, xzMagic):
+		log.Printf("decompressing xz\n")
+
+		x, err := xz.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xz stream: %v", err)
+		}
+
+		return ioutil.NopCloser(x), nil
+	}
+
+	return ioutil.NopCloser(br), nil
+}
+
+// A zip archive that was written to a temporary file in the cache, as its
+// directory is at the end, and of which the XML file is read.
+type zipReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func unzip(r io.Reader) (io.ReadCloser, error) {
+	cache, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(cache, "register_*.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	z := &zipReader{file: file}
+
+	size, err := io.Copy(file, r)
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		z.Close()
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	entry, err := zipEntry(archive.File)
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+
+	log.Printf("reading %s from zip archive\n", entry.Name)
+
+	z.ReadCloser, err = entry.Open()
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// Returns the XML file of an archive, which must be the only one.
+func zipEntry(files []*zip.File) (*zip.File, error) {
+	var found []*zip.File
+
+	for _, f := range files {
+		if strings.EqualFold(path.Ext(f.Name), ".xml") {
+			found = append(found, f)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no XML file in zip archive")
+	case 1:
+		return found[0], nil
+	}
+
+	return nil, fmt.Errorf("%d XML files in zip archive, expected one", len(found))
+}
+
+func (z *zipReader) Close() error {
+	var err error
+
+	if z.ReadCloser != nil {
+		err = z.ReadCloser.Close()
+	}
+
+	z.file.Close()
+	os.Remove(z.file.Name())
+
+	return err
+}
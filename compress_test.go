@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Returns a zip archive with a file for each name, which contains content.
+func zipArchive(t *testing.T, content string, names ...string) []byte {
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Write([]byte(content))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Returns content compressed with xz.
+func xzStream(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte(content))
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Point the user's cache directory at a temporary directory, which is removed
+// by the returned function, along with restoring the cache directory.
+func tempCache(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := os.Getenv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", dir)
+
+	return dir, func() {
+		os.Setenv("XDG_CACHE_HOME", cache)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	// Zip archives are spooled to the user's cache.
+	dir, restore := tempCache(t)
+	defer restore()
+
+	var gz bytes.Buffer
+
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(registerXML))
+	w.Close()
+
+	tests := map[string]struct {
+		input []byte
+	}{
+		"plain": {[]byte(registerXML)},
+		"gzip":  {gz.Bytes()},
+		"zip":   {zipArchive(t, registerXML, "README.txt", "register.XML")},
+		"xz":    {xzStream(t, registerXML)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := decompress(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if string(output) != registerXML {
+				t.Errorf("expected the register, got %d bytes", len(output))
+			}
+
+			if files, _ := filepath.Glob(filepath.Join(dir, "eu_transparency", "*")); len(files) != 0 {
+				t.Errorf("expected the cache to be empty, got %v", files)
+			}
+		})
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	_, restore := tempCache(t)
+	defer restore()
+
+	stream := xzStream(t, registerXML)
+
+	tests := map[string]struct {
+		input    []byte
+		expected string
+	}{
+		"zip without xml":   {zipArchive(t, "", "README.txt"), "no XML file"},
+		"zip with two xml":  {zipArchive(t, "", "a.xml", "b.xml"), "2 XML files"},
+		"truncated zip":     {zipArchive(t, "", "a.xml")[:10], "invalid zip archive"},
+		"truncated gzip":    {[]byte{0x1f, 0x8b, 0x08}, "EOF"},
+		"truncated xz":      {[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, "invalid xz stream"},
+		"truncated xz data": {stream[:len(stream)-10], "unexpected EOF"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := decompress(bytes.NewReader(test.input))
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+				r.Close()
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error with %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Progress of the crawl of a single host ID.
+type checkpoint struct {
+	hostID      string
+	lastPage    string // Path of the last page that was stored.
+	nextPage    string // Path of the page that follows, if any.
+	pages       int
+	completedAt pq.NullTime
+}
+
+// A crawl is resumable if it was interrupted before the last page.
+func (c checkpoint) resumable() bool {
+	return !c.completedAt.Valid && c.nextPage != ""
+}
+
+// Where the crawl of a host ID is stored, which is the database except in
+// tests.
+type crawlStore interface {
+	loadCheckpoint(hostID string) (checkpoint, error)
+	// Returns how many of the given meetings are already linked to the host.
+	storedMeetings(job scrapeJob, meetings []meeting) (int, error)
+	// Store the meetings and unresolved members of a page, along with the
+	// checkpoint of the crawl after it.
+	savePage(job scrapeJob, meetings []meeting, unresolved []unresolvedMember, cp checkpoint, run *importRun) error
+}
+
+type crawlDB struct {
+	db *sql.DB
+}
+
+func (c crawlDB) loadCheckpoint(hostID string) (checkpoint, error) {
+	return loadCheckpoint(hostID, c.db)
+}
+
+func (c crawlDB) storedMeetings(job scrapeJob, meetings []meeting) (int, error) {
+	return storedMeetings(job, meetings, c.db)
+}
+
+func (c crawlDB) savePage(job scrapeJob, meetings []meeting, unresolved []unresolvedMember, cp checkpoint, run *importRun) error {
+	leaderMeetings, memberMeetings := &meetings, &[]meeting{}
+	if !job.byLeader {
+		leaderMeetings, memberMeetings = memberMeetings, leaderMeetings
+	}
+
+	if err := bulkUpsertMeetings(*job.leader.ID, leaderMeetings, memberMeetings, run, c.db); err != nil {
+		return err
+	}
+
+	if err := saveUnresolved(unresolved, c.db); err != nil {
+		return err
+	}
+
+	return saveCheckpoint(cp, c.db)
+}
+
+// Returns the checkpoint of a host ID, or an empty checkpoint if there is none.
+func loadCheckpoint(hostID string, db *sql.DB) (checkpoint, error) {
+	cp := checkpoint{hostID: hostID}
+
+	err := db.QueryRow(`
+		SELECT checkpoint_last_page, checkpoint_next_page, checkpoint_pages, checkpoint_completed_at
+		FROM crawl_checkpoints
+		WHERE host_id = $1`,
+		hostID,
+	).Scan(&cp.lastPage, &cp.nextPage, &cp.pages, &cp.completedAt)
+	if err == sql.ErrNoRows {
+		return cp, nil
+	}
+
+	return cp, err
+}
+
+func saveCheckpoint(cp checkpoint, db *sql.DB) error {
+	_, err := db.Exec(`
+		INSERT INTO crawl_checkpoints (host_id, checkpoint_last_page, checkpoint_next_page, checkpoint_pages, checkpoint_updated_at, checkpoint_completed_at)
+		VALUES ($1, $2, $3, $4, now(), $5)
+		ON CONFLICT (host_id) DO UPDATE SET
+			checkpoint_last_page = EXCLUDED.checkpoint_last_page,
+			checkpoint_next_page = EXCLUDED.checkpoint_next_page,
+			checkpoint_pages = EXCLUDED.checkpoint_pages,
+			checkpoint_updated_at = EXCLUDED.checkpoint_updated_at,
+			checkpoint_completed_at = EXCLUDED.checkpoint_completed_at`,
+		cp.hostID, cp.lastPage, cp.nextPage, cp.pages, cp.completedAt,
+	)
+
+	return err
+}
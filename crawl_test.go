@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	firstPage = "/transparencyinitiative/meetings/meeting.do?host=829436d0-1850-424f-aebe-6dd76c793be2"
+	finalPage = firstPage + "&d-6679426-p=2"
+)
+
+func TestCheckpointResumable(t *testing.T) {
+	completed := pq.NullTime{Time: time.Now(), Valid: true}
+
+	tests := map[string]struct {
+		input    checkpoint
+		expected bool
+	}{
+		"without crawl": {checkpoint{}, false},
+		"interrupted":   {checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1}, true},
+		"final page":    {checkpoint{lastPage: finalPage, pages: 2}, false},
+		"completed":     {checkpoint{lastPage: finalPage, pages: 2, completedAt: completed}, false},
+		"stopped early": {checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1, completedAt: completed}, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if output := test.input.resumable(); output != test.expected {
+				t.Errorf("expected resumable to be %t, got %t", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestCrawlHost(t *testing.T) {
+	job := fixtureJobs(t)[0]
+	completed := pq.NullTime{Time: time.Now(), Valid: true}
+
+	tests := map[string]struct {
+		checkpoint  *checkpoint // Stored before the crawl, if any.
+		maxPages    int
+		incremental bool
+		stored      int // Meetings on each page that are stored already.
+		count       int
+		expected    checkpoint
+		resumable   bool
+	}{
+		"first crawl": {
+			nil, 0, false, 0, 5,
+			checkpoint{lastPage: finalPage, pages: 2}, false,
+		},
+		"resumable": {
+			&checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1}, 0, false, 0, 2,
+			checkpoint{lastPage: finalPage, pages: 2}, false,
+		},
+		"completed": {
+			&checkpoint{lastPage: finalPage, pages: 2, completedAt: completed}, 0, false, 0, 5,
+			checkpoint{lastPage: finalPage, pages: 2}, false,
+		},
+		"max pages": {
+			nil, 1, false, 0, 3,
+			checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1}, true,
+		},
+		"resumed after max pages": {
+			&checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1}, 1, false, 0, 2,
+			checkpoint{lastPage: finalPage, pages: 2}, false,
+		},
+		"incremental": {
+			nil, 0, true, 1, 3,
+			checkpoint{lastPage: firstPage, nextPage: finalPage, pages: 1}, false,
+		},
+		"incremental without stored meetings": {
+			nil, 0, true, 0, 5,
+			checkpoint{lastPage: finalPage, pages: 2}, false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := scrapeOptions{
+				host:        meetingsURL,
+				interval:    time.Millisecond,
+				attempts:    1,
+				maxPages:    test.maxPages,
+				incremental: test.incremental,
+			}
+
+			s := newScraper(&fileFetcher{filepath.Join("fixtures", "meetings")}, opts)
+			defer s.Stop()
+
+			store := newMemStore()
+			store.stored = test.stored
+
+			if test.checkpoint != nil {
+				cp := *test.checkpoint
+				cp.hostID = job.hostID
+				store.checkpoints[job.hostID] = cp
+			}
+
+			count, err := crawlHost(s, &gazetteer{}, job, opts, &importRun{}, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if count != test.count {
+				t.Errorf("expected %d meetings, got %d", test.count, count)
+			}
+
+			cp := store.checkpoints[job.hostID]
+
+			if cp.lastPage != test.expected.lastPage || cp.nextPage != test.expected.nextPage || cp.pages != test.expected.pages {
+				t.Errorf("expected checkpoint %+v, got %+v", test.expected, cp)
+			}
+
+			if cp.resumable() != test.resumable {
+				t.Errorf("expected resumable to be %t, got %t", test.resumable, cp.resumable())
+			}
+		})
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os/exec"
 	"path/filepath"
-	"time"
+	"sort"
+	"strings"
 )
 
 type postgres struct {
@@ -38,7 +41,7 @@ func databaseConn(cfg map[string]string) (postgres, error) {
 	}, nil
 }
 
-func (p *postgres) Backup() error {
+func (p *postgres) Backup(path string) error {
 	// If a password is present, add a delimiter.
 	var delimit string
 	if p.pass != "" {
@@ -51,9 +54,6 @@ func (p *postgres) Backup() error {
 		p.user, delimit, p.pass, p.host, p.port,
 	)
 
-	name := fmt.Sprintf("DB_%s.dump", time.Now().Format("2006-01-02"))
-	path := filepath.Join("database", "backups", name)
-
 	// See https://www.postgresql.org/docs/10/static/app-pgdump.html for commands.
 	cmd := exec.Command("pg_dump", "--dbname", connStr, "-Z", "9", "-F", "c", "-f", path)
 
@@ -68,6 +68,108 @@ func (p *postgres) Backup() error {
 	return nil
 }
 
+// Apply each migration in dir that has not been applied yet. Migrations are
+// applied in the lexical order of their file names, e.g. "001_name.sql".
+func (p *postgres) Migrate(dir string, dryRun bool) error {
+	_, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			migration_version     TEXT NOT NULL PRIMARY KEY,
+			migration_applied_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	applied := map[string]bool{}
+
+	rows, err := p.db.Query(`SELECT migration_version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".sql")
+
+		if applied[version] {
+			continue
+		}
+
+		if dryRun {
+			log.Printf("dry run, pending migration: %s\n", version)
+			continue
+		}
+
+		if err := p.migrateFile(file, version); err != nil {
+			return fmt.Errorf("could not apply migration %s: %v", version, err)
+		}
+
+		log.Printf("applied migration: %s\n", version)
+	}
+
+	return nil
+}
+
+// Apply a single migration and record it, in one transaction.
+func (p *postgres) migrateFile(file, version string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	txn, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	if _, err := txn.Exec(string(data)); err != nil {
+		return err
+	}
+
+	_, err = txn.Exec(`INSERT INTO schema_migrations (migration_version) VALUES ($1)`, version)
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	success = true
+
+	return nil
+}
+
 func (p *postgres) Close() {
 	p.db.Close()
 }
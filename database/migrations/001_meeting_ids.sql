@@ -0,0 +1,14 @@
+-- Meetings are identified by a content-addressed meeting_id, which replaces the
+-- unique constraint on their date, canceled status, location and subjects.
+DO $$
+DECLARE
+  name TEXT;
+BEGIN
+  FOR name IN
+    SELECT conname FROM pg_constraint
+    WHERE conrelid = 'meetings'::regclass AND contype = 'u'
+  LOOP
+    EXECUTE format('ALTER TABLE meetings DROP CONSTRAINT %I', name);
+  END LOOP;
+END;
+$$;
@@ -0,0 +1,9 @@
+-- Progress of the crawl of each host ID, so an interrupted crawl can resume.
+CREATE TABLE IF NOT EXISTS crawl_checkpoints (
+  host_id                   UUID NOT NULL PRIMARY KEY,
+  checkpoint_last_page      TEXT NOT NULL,
+  checkpoint_next_page      TEXT NOT NULL,
+  checkpoint_pages          INT NOT NULL,
+  checkpoint_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+  checkpoint_completed_at   TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,13 @@
+-- Cabinet member names on meeting pages that could not be matched to a member.
+CREATE TABLE IF NOT EXISTS unresolved_members (
+  host_id                   UUID NOT NULL,
+  unresolved_text           TEXT NOT NULL,
+  unresolved_candidate      TEXT NOT NULL,
+  unresolved_candidate_id   UUID,
+  unresolved_score          DOUBLE PRECISION NOT NULL,
+  unresolved_page           TEXT NOT NULL,
+  unresolved_seen_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  unresolved_dismissed      BOOLEAN NOT NULL DEFAULT FALSE,
+  unresolved_member_id      UUID,
+  PRIMARY KEY(host_id, unresolved_text)
+);
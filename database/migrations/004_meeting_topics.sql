@@ -0,0 +1,16 @@
+-- Topics of each meeting, split from meeting_subjects. See meetingTopics in topics.go.
+CREATE TABLE IF NOT EXISTS meeting_topics (
+  meeting_id          UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  topic_name          TEXT NOT NULL,
+  PRIMARY KEY(meeting_id, topic_name)
+);
+
+CREATE INDEX IF NOT EXISTS index_meeting_topics_on_name_trigram ON meeting_topics USING GIN(topic_name gin_trgm_ops);
+
+-- Split existing subjects on semicolons and line breaks, until the next scrape
+-- replaces them with the topics of meetingTopics.
+INSERT INTO meeting_topics (meeting_id, topic_name)
+SELECT DISTINCT meeting_id, btrim(topic)
+FROM meetings, regexp_split_to_table(meeting_subjects, '[;\n]') AS topic
+WHERE btrim(topic) <> ''
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,8 @@
+-- Normalized meeting locations, found in database/gazetteer.json and country_names.
+ALTER TABLE meetings
+  ADD COLUMN IF NOT EXISTS meeting_city        TEXT,
+  ADD COLUMN IF NOT EXISTS meeting_country     INT REFERENCES countries(country_id),
+  ADD COLUMN IF NOT EXISTS meeting_latitude    DOUBLE PRECISION,
+  ADD COLUMN IF NOT EXISTS meeting_longitude   DOUBLE PRECISION;
+
+CREATE INDEX IF NOT EXISTS index_meetings_on_country ON meetings(meeting_country);
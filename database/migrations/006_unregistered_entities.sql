@@ -0,0 +1,19 @@
+-- Names of the entities on meeting pages, including those without a register number.
+ALTER TABLE organizations_meetings
+  ADD COLUMN IF NOT EXISTS entity_name TEXT;
+
+CREATE TABLE IF NOT EXISTS unregistered_entities (
+  entity_id                   INT generated by default AS identity PRIMARY KEY,
+  entity_name                 TEXT NOT NULL UNIQUE,
+  entity_organization_id      TEXT REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE SET NULL,
+  entity_match_score          REAL,
+  entity_matched_at           TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS unregistered_entities_meetings (
+  entity_id                   INT NOT NULL REFERENCES unregistered_entities(entity_id) ON DELETE CASCADE,
+  meeting_id                  UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  PRIMARY KEY(entity_id, meeting_id)
+);
+
+CREATE INDEX IF NOT EXISTS index_unregistered_entities_meetings_on_meeting ON unregistered_entities_meetings(meeting_id);
@@ -0,0 +1,95 @@
+-- The full interestRepresentative record: category, goals, website, head office,
+-- persons, financial data, accreditations and interests.
+ALTER TABLE organizations
+  ADD COLUMN IF NOT EXISTS organization_category       TEXT,
+  ADD COLUMN IF NOT EXISTS organization_subsection     TEXT,
+  ADD COLUMN IF NOT EXISTS organization_goals          TEXT,
+  ADD COLUMN IF NOT EXISTS organization_website        TEXT,
+  ADD COLUMN IF NOT EXISTS organization_address        TEXT,
+  ADD COLUMN IF NOT EXISTS organization_post_code      TEXT,
+  ADD COLUMN IF NOT EXISTS organization_city           TEXT,
+  ADD COLUMN IF NOT EXISTS organization_persons        INT,
+  ADD COLUMN IF NOT EXISTS organization_persons_fte    REAL;
+
+ALTER TABLE organizations_history
+  ADD COLUMN IF NOT EXISTS organization_category       TEXT,
+  ADD COLUMN IF NOT EXISTS organization_subsection     TEXT,
+  ADD COLUMN IF NOT EXISTS organization_goals          TEXT,
+  ADD COLUMN IF NOT EXISTS organization_website        TEXT,
+  ADD COLUMN IF NOT EXISTS organization_address        TEXT,
+  ADD COLUMN IF NOT EXISTS organization_post_code      TEXT,
+  ADD COLUMN IF NOT EXISTS organization_city           TEXT,
+  ADD COLUMN IF NOT EXISTS organization_persons        INT,
+  ADD COLUMN IF NOT EXISTS organization_persons_fte    REAL;
+
+CREATE TABLE IF NOT EXISTS organization_finances (
+  organization_id             TEXT NOT NULL PRIMARY KEY REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  finance_year_start          DATE,
+  finance_year_end            DATE,
+  finance_costs               TEXT,
+  finance_turnover            TEXT,
+  finance_grants              TEXT,
+  finance_procurement         TEXT,
+  finance_other               TEXT
+);
+
+CREATE TABLE IF NOT EXISTS organization_accreditations (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  accreditation_first_name    TEXT NOT NULL,
+  accreditation_last_name     TEXT NOT NULL,
+  accreditation_start_date    DATE,
+  accreditation_end_date      DATE,
+  PRIMARY KEY(organization_id, accreditation_first_name, accreditation_last_name)
+);
+
+CREATE TABLE IF NOT EXISTS organization_interests (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  interest_name               TEXT NOT NULL,
+  PRIMARY KEY(organization_id, interest_name)
+);
+
+CREATE INDEX IF NOT EXISTS index_organizations_on_category ON organizations(organization_category, organization_subsection);
+CREATE INDEX IF NOT EXISTS index_organization_interests_on_name ON organization_interests(interest_name);
+
+-- Snapshot the new columns in organizations_history as well.
+CREATE OR REPLACE FUNCTION fn_organizations_history() RETURNS TRIGGER AS $BODY$
+  BEGIN
+    IF NEW.organization_updated_at > OLD.organization_updated_at THEN
+      INSERT INTO organizations_history (
+        organization_id,
+        organization_name,
+        organization_country,
+        organization_legal_status,
+        organization_updated_at,
+        organization_registered_at,
+        organization_category,
+        organization_subsection,
+        organization_goals,
+        organization_website,
+        organization_address,
+        organization_post_code,
+        organization_city,
+        organization_persons,
+        organization_persons_fte
+      ) VALUES (
+        OLD.organization_id,
+        OLD.organization_name,
+        OLD.organization_country,
+        OLD.organization_legal_status,
+        OLD.organization_updated_at,
+        OLD.organization_registered_at,
+        OLD.organization_category,
+        OLD.organization_subsection,
+        OLD.organization_goals,
+        OLD.organization_website,
+        OLD.organization_address,
+        OLD.organization_post_code,
+        OLD.organization_city,
+        OLD.organization_persons,
+        OLD.organization_persons_fte
+      );
+    END IF;
+    RETURN NEW;
+  END;
+$BODY$ LANGUAGE plpgsql;
+
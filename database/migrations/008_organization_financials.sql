@@ -0,0 +1,41 @@
+-- Declared financial years of each organization, kept across imports. This
+-- replaces organization_finances, which only had the last declared year.
+CREATE TABLE IF NOT EXISTS organization_financials (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  financial_year              INT NOT NULL,
+  financial_year_start        DATE,
+  financial_year_end          DATE NOT NULL,
+  financial_costs             TEXT,
+  financial_costs_lower       NUMERIC,
+  financial_costs_upper       NUMERIC,
+  financial_eu_grants         NUMERIC,
+  financial_other_funding     NUMERIC,
+  financial_turnover          TEXT,
+  financial_procurement       TEXT,
+  PRIMARY KEY(organization_id, financial_year)
+);
+
+ALTER TABLE organization_financials
+  ADD COLUMN IF NOT EXISTS financial_turnover          TEXT,
+  ADD COLUMN IF NOT EXISTS financial_procurement       TEXT;
+
+-- Copy the last declared years over. The amounts are parsed by the import, so
+-- they are left NULL until the next sync orgs replaces the same years.
+DO $$
+  BEGIN
+    IF to_regclass('organization_finances') IS NOT NULL THEN
+      INSERT INTO organization_financials (
+        organization_id, financial_year, financial_year_start, financial_year_end,
+        financial_costs, financial_turnover, financial_procurement
+      )
+      SELECT
+        organization_id, extract(YEAR FROM finance_year_end)::INT, finance_year_start, finance_year_end,
+        finance_costs, finance_turnover, finance_procurement
+      FROM organization_finances
+      WHERE finance_year_end IS NOT NULL
+      ON CONFLICT (organization_id, financial_year) DO NOTHING;
+
+      DROP TABLE organization_finances;
+    END IF;
+  END;
+$$;
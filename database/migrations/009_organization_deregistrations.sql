@@ -0,0 +1,8 @@
+-- Organizations that disappear from the register. See processXML in organizations.go.
+CREATE SEQUENCE IF NOT EXISTS organization_imports;
+
+ALTER TABLE organizations
+  ADD COLUMN IF NOT EXISTS organization_last_seen_import BIGINT,
+  ADD COLUMN IF NOT EXISTS organization_deregistered_at  TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS index_organizations_on_deregistered_at ON organizations(organization_deregistered_at);
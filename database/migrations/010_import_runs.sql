@@ -0,0 +1,36 @@
+-- A ledger of import runs. See runs.go.
+CREATE TABLE IF NOT EXISTS import_runs (
+  run_id                      BIGINT generated by default AS identity PRIMARY KEY,
+  run_kind                    TEXT NOT NULL,
+  run_source                  TEXT NOT NULL,
+  run_sha256                  TEXT,
+  run_started_at              TIMESTAMP WITH TIME ZONE NOT NULL,
+  run_finished_at             TIMESTAMP WITH TIME ZONE,
+  run_status                  TEXT NOT NULL,
+  run_inserted                BIGINT NOT NULL DEFAULT 0,
+  run_updated                 BIGINT NOT NULL DEFAULT 0,
+  run_unchanged               BIGINT NOT NULL DEFAULT 0,
+  run_skipped                 BIGINT NOT NULL DEFAULT 0,
+  run_errors                  TEXT[]
+);
+
+-- The rows that each run inserted, updated or deregistered, by their key.
+CREATE TABLE IF NOT EXISTS import_run_changes (
+  run_id                      BIGINT NOT NULL REFERENCES import_runs(run_id) ON DELETE CASCADE,
+  change_kind                 TEXT NOT NULL,
+  change_key                  TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS index_import_runs_on_kind ON import_runs(run_kind, run_id);
+CREATE INDEX IF NOT EXISTS index_import_run_changes_on_run ON import_run_changes(run_id, change_key);
+
+-- Imports are now identified by their run. Continue after the last import ID,
+-- so organizations are not taken as seen by a run with the same ID.
+DO $$
+  BEGIN
+    IF EXISTS (SELECT 1 FROM pg_class WHERE relkind = 'S' AND relname = 'organization_imports') THEN
+      PERFORM setval(pg_get_serial_sequence('import_runs', 'run_id'), nextval('organization_imports'));
+      DROP SEQUENCE organization_imports;
+    END IF;
+  END;
+$$;
@@ -0,0 +1,4 @@
+-- Response headers of the register, for conditional requests on the next import.
+ALTER TABLE import_runs
+  ADD COLUMN IF NOT EXISTS run_etag            TEXT,
+  ADD COLUMN IF NOT EXISTS run_last_modified   TEXT;
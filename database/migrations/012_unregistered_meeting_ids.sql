@@ -0,0 +1,50 @@
+-- Entities without a register number used to be hashed as "Unregistered" in
+-- the meeting_id, so meetings that only differed in those entities were merged.
+-- They are now hashed by their name, see meetingID in meetings.go. This
+-- recomputes the IDs of meetings with unregistered entities of which the names
+-- were stored. Children follow through ON UPDATE CASCADE, and an ID that is
+-- already taken, such as by a meeting that was scraped again, is left as is.
+-- Register numbers that are not in organizations were never stored, so the
+-- ID of a meeting with such an entity is not reproduced until it is scraped
+-- again.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- Same as canonicalText in meetings.go.
+CREATE OR REPLACE FUNCTION pg_temp.canonical_text(s TEXT) RETURNS TEXT AS $$
+  SELECT lower(regexp_replace(regexp_replace(s, '\s+', ' ', 'g'), '^ | $', '', 'g'))
+$$ LANGUAGE SQL IMMUTABLE;
+
+WITH hosts AS (
+  SELECT meeting_id, leader_id FROM leaders_meetings
+  UNION
+  SELECT meeting_id, leader_id FROM members_meetings
+),
+entities AS (
+  SELECT meeting_id, organization_id AS entity_key
+  FROM organizations_meetings
+  UNION
+  SELECT unregistered_entities_meetings.meeting_id, 'u:' || pg_temp.canonical_text(unregistered_entities.entity_name)
+  FROM unregistered_entities_meetings
+  INNER JOIN unregistered_entities USING (entity_id)
+),
+ids AS (
+  SELECT meetings.meeting_id, uuid_generate_v5(
+    '675e69f0-cfdf-5071-9161-77873d53a549',
+    'host=' || hosts.leader_id::TEXT || E'\n' ||
+    'date=' || to_char(meetings.meeting_date, 'YYYY-MM-DD') || E'\n' ||
+    'location=' || pg_temp.canonical_text(meetings.meeting_location) || E'\n' ||
+    'subjects=' || pg_temp.canonical_text(meetings.meeting_subjects) || E'\n' ||
+    'entities=' || COALESCE((
+      SELECT string_agg(entities.entity_key, ',' ORDER BY entities.entity_key COLLATE "C")
+      FROM entities
+      WHERE entities.meeting_id = meetings.meeting_id
+    ), '')
+  ) AS new_id
+  FROM meetings
+  INNER JOIN hosts USING (meeting_id)
+  WHERE meetings.meeting_id IN (SELECT meeting_id FROM unregistered_entities_meetings)
+)
+UPDATE meetings SET meeting_id = ids.new_id
+FROM ids
+WHERE meetings.meeting_id = ids.meeting_id
+  AND NOT EXISTS (SELECT 1 FROM meetings AS taken WHERE taken.meeting_id = ids.new_id);
@@ -0,0 +1,12 @@
+-- Entities on meeting pages with a register number that is not (yet) in
+-- organizations, such as an organization that registered after its meeting was
+-- scraped. They are moved to organizations_meetings once sync orgs imports the
+-- organization, see linkPendingMeetings in meetings.go.
+CREATE TABLE IF NOT EXISTS pending_organizations_meetings (
+  organization_id             TEXT NOT NULL,
+  meeting_id                  UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  entity_name                 TEXT,
+  PRIMARY KEY(organization_id, meeting_id)
+);
+
+CREATE INDEX IF NOT EXISTS index_pending_organizations_meetings_on_meeting ON pending_organizations_meetings(meeting_id);
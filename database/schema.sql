@@ -7,6 +7,28 @@ CREATE DATABASE eu_transparency;
 -- see https://www.postgresql.org/docs/10/static/pgtrgm.html
 CREATE EXTENSION IF NOT EXISTS "pg_trgm";
 
+-- Migrations in database/migrations that are already part of this schema.
+-- See Migrate in database.go.
+CREATE TABLE schema_migrations (
+  migration_version     TEXT NOT NULL PRIMARY KEY,
+  migration_applied_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+INSERT INTO schema_migrations (migration_version) VALUES
+  ('001_meeting_ids'),
+  ('002_crawl_checkpoints'),
+  ('003_unresolved_members'),
+  ('004_meeting_topics'),
+  ('005_meeting_locations'),
+  ('006_unregistered_entities'),
+  ('007_organization_details'),
+  ('008_organization_financials'),
+  ('009_organization_deregistrations'),
+  ('010_import_runs'),
+  ('011_import_run_validators'),
+  ('012_unregistered_meeting_ids'),
+  ('013_pending_organizations_meetings');
+
 CREATE TABLE departments (
   department_abbreviation TEXT NOT NULL PRIMARY KEY,
   department_name         TEXT NOT NULL,
@@ -61,23 +83,54 @@ INSERT INTO country_names (country_code, country_name) VALUES
 ('UG', 'UGANDA'), ('US', 'UNITED STATES'), ('UY', 'URUGUAY'), ('VE', 'VENEZUELA'), ('VN', 'VIETNAM'), ('XK', 'KOSOVO'), ('ZA', 'SOUTH AFRICA'),
 ('ZW', 'ZIMBABWE');
 
+-- The meeting_id is a v5 UUID of the meeting's host, date, location, subjects and entities.
+-- See meetingID in meetings.go. The meeting_location is as listed, the city, country and
+-- coordinates are normalized with database/gazetteer.json and are NULL if not found.
 CREATE TABLE meetings (
-  -- meeting_id                  INT generated by default AS identity PRIMARY KEY,
   meeting_id                  UUID PRIMARY KEY,
   meeting_date                DATE NOT NULL,
   meeting_canceled            BOOLEAN NOT NULL DEFAULT FALSE, 
   meeting_location            TEXT NOT NULL,
   meeting_subjects            TEXT NOT NULL,
-  UNIQUE(meeting_date, meeting_canceled, meeting_location, meeting_subjects)
+  meeting_city                TEXT,
+  meeting_country             INT REFERENCES countries(country_id),
+  meeting_latitude            DOUBLE PRECISION,
+  meeting_longitude           DOUBLE PRECISION
 );
 
+-- Topics of each meeting, split from meeting_subjects. See meetingTopics in topics.go.
+-- For example, all meetings about 5G:
+--   SELECT DISTINCT meeting_id FROM meeting_topics WHERE topic_name ILIKE '%5G%';
+CREATE TABLE meeting_topics (
+  meeting_id          UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  topic_name          TEXT NOT NULL,
+  PRIMARY KEY(meeting_id, topic_name)
+);
+
+-- The category and subsection are the section of the register the organization
+-- is listed in. The address is that of its head office. The persons are those
+-- involved in its activities, and the number of full time equivalents.
+-- The last_seen_import is the run_id in import_runs of the last import that
+-- listed the organization. Organizations that were not seen in the last
+-- complete import are marked with the time they were found to be deregistered.
 CREATE TABLE organizations (
   organization_id             TEXT NOT NULL PRIMARY KEY,
   organization_name           TEXT NOT NULL,
   organization_country        INT NOT NULL REFERENCES countries(country_id),
   organization_legal_status   TEXT NOT NULL,
   organization_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-  organization_registered_at  TIMESTAMP WITH TIME ZONE NOT NULL
+  organization_registered_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+  organization_category       TEXT,
+  organization_subsection     TEXT,
+  organization_goals          TEXT,
+  organization_website        TEXT,
+  organization_address        TEXT,
+  organization_post_code      TEXT,
+  organization_city           TEXT,
+  organization_persons        INT,
+  organization_persons_fte    REAL,
+  organization_last_seen_import BIGINT,
+  organization_deregistered_at  TIMESTAMP WITH TIME ZONE
 );
 
 CREATE TABLE organizations_history (
@@ -87,15 +140,92 @@ CREATE TABLE organizations_history (
   organization_legal_status   TEXT NOT NULL,
   organization_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
   organization_registered_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+  organization_category       TEXT,
+  organization_subsection     TEXT,
+  organization_goals          TEXT,
+  organization_website        TEXT,
+  organization_address        TEXT,
+  organization_post_code      TEXT,
+  organization_city           TEXT,
+  organization_persons        INT,
+  organization_persons_fte    REAL,
   PRIMARY KEY(organization_id, organization_updated_at)
 );
 
+-- Declared financial years of each organization, which are kept across imports.
+-- Costs are declared as an amount or a range, which is parsed into a lower and
+-- upper bound. An open bound is NULL. See parseAmountRange in financials.go.
+-- Turnover and procurement are kept as declared.
+-- For example, the lobbying budget of an organization over the years:
+--   SELECT financial_year, financial_costs_lower, financial_costs_upper
+--   FROM organization_financials WHERE organization_id = '03181945560-59' ORDER BY financial_year;
+CREATE TABLE organization_financials (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  financial_year              INT NOT NULL,
+  financial_year_start        DATE,
+  financial_year_end          DATE NOT NULL,
+  financial_costs             TEXT,
+  financial_costs_lower       NUMERIC,
+  financial_costs_upper       NUMERIC,
+  financial_eu_grants         NUMERIC,
+  financial_other_funding     NUMERIC,
+  financial_turnover          TEXT,
+  financial_procurement       TEXT,
+  PRIMARY KEY(organization_id, financial_year)
+);
+
+-- Persons with access to the European Parliament on behalf of an organization.
+CREATE TABLE organization_accreditations (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  accreditation_first_name    TEXT NOT NULL,
+  accreditation_last_name     TEXT NOT NULL,
+  accreditation_start_date    DATE,
+  accreditation_end_date      DATE,
+  PRIMARY KEY(organization_id, accreditation_first_name, accreditation_last_name)
+);
+
+-- EU policy fields that an organization follows, such as "Climate Action".
+CREATE TABLE organization_interests (
+  organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  interest_name               TEXT NOT NULL,
+  PRIMARY KEY(organization_id, interest_name)
+);
+
+-- The entity_name is the organization's name as listed on the meeting page.
 CREATE TABLE organizations_meetings (
   organization_id             TEXT NOT NULL REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE CASCADE,
   meeting_id                  UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  entity_name                 TEXT,
   PRIMARY KEY(organization_id, meeting_id)
 );
 
+-- Entities with a register number that is not (yet) in organizations. They
+-- are moved to organizations_meetings once the organization is imported, see
+-- linkPendingMeetings in meetings.go.
+CREATE TABLE pending_organizations_meetings (
+  organization_id             TEXT NOT NULL,
+  meeting_id                  UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  entity_name                 TEXT,
+  PRIMARY KEY(organization_id, meeting_id)
+);
+
+-- Entities on meeting pages without a register number, by their name. The
+-- organization is a suggested match that is set by "match entities", see
+-- matchEntities in entities.go.
+CREATE TABLE unregistered_entities (
+  entity_id                   INT generated by default AS identity PRIMARY KEY,
+  entity_name                 TEXT NOT NULL UNIQUE,
+  entity_organization_id      TEXT REFERENCES organizations(organization_id) ON UPDATE CASCADE ON DELETE SET NULL,
+  entity_match_score          REAL,
+  entity_matched_at           TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE unregistered_entities_meetings (
+  entity_id                   INT NOT NULL REFERENCES unregistered_entities(entity_id) ON DELETE CASCADE,
+  meeting_id                  UUID NOT NULL REFERENCES meetings(meeting_id) ON UPDATE CASCADE ON DELETE CASCADE,
+  PRIMARY KEY(entity_id, meeting_id)
+);
+
 CREATE TABLE leaders (
   leader_id           UUID NOT NULL PRIMARY KEY,
   leader_name         TEXT NOT NULL,
@@ -135,20 +265,108 @@ CREATE TABLE members_meetings (
   PRIMARY KEY(member_id, meeting_id)
 );
 
+-- Progress of the crawl of each host ID, so an interrupted crawl can resume.
+-- The next page is empty once the last page was stored.
+CREATE TABLE crawl_checkpoints (
+  host_id                   UUID NOT NULL PRIMARY KEY,
+  checkpoint_last_page      TEXT NOT NULL,
+  checkpoint_next_page      TEXT NOT NULL,
+  checkpoint_pages          INT NOT NULL,
+  checkpoint_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+  checkpoint_completed_at   TIMESTAMP WITH TIME ZONE
+);
+
+-- Cabinet member names on meeting pages that could not be matched to a member,
+-- with the best candidate. See reviewMembers in unresolved.go.
+CREATE TABLE unresolved_members (
+  host_id                   UUID NOT NULL,
+  unresolved_text           TEXT NOT NULL,
+  unresolved_candidate      TEXT NOT NULL,
+  unresolved_candidate_id   UUID,
+  unresolved_score          DOUBLE PRECISION NOT NULL,
+  unresolved_page           TEXT NOT NULL,
+  unresolved_seen_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  unresolved_dismissed      BOOLEAN NOT NULL DEFAULT FALSE,
+  unresolved_member_id      UUID,
+  PRIMARY KEY(host_id, unresolved_text)
+);
+
+-- Each run of "sync orgs", "sync departments" and "scrape meetings", with the
+-- number of rows it inserted, updated, left unchanged or skipped. See runs.go.
+-- The ETag, Last-Modified and SHA-256 of the register are compared on the next
+-- "sync orgs", which records an unchanged register with the status unchanged.
+CREATE TABLE import_runs (
+  run_id                      BIGINT generated by default AS identity PRIMARY KEY,
+  run_kind                    TEXT NOT NULL,
+  run_source                  TEXT NOT NULL,
+  run_sha256                  TEXT,
+  run_etag                    TEXT,
+  run_last_modified           TEXT,
+  run_started_at              TIMESTAMP WITH TIME ZONE NOT NULL,
+  run_finished_at             TIMESTAMP WITH TIME ZONE,
+  run_status                  TEXT NOT NULL,
+  run_inserted                BIGINT NOT NULL DEFAULT 0,
+  run_updated                 BIGINT NOT NULL DEFAULT 0,
+  run_unchanged               BIGINT NOT NULL DEFAULT 0,
+  run_skipped                 BIGINT NOT NULL DEFAULT 0,
+  run_errors                  TEXT[]
+);
+
+-- The rows that each run inserted, updated or deregistered, by their key.
+CREATE TABLE import_run_changes (
+  run_id                      BIGINT NOT NULL REFERENCES import_runs(run_id) ON DELETE CASCADE,
+  change_kind                 TEXT NOT NULL,
+  change_key                  TEXT NOT NULL
+);
+
 CREATE INDEX index_organizations_on_name_trigram ON organizations USING GIN(organization_name gin_trgm_ops);
 CREATE INDEX index_leaders_on_name_trigram ON leaders USING GIN(leader_name gin_trgm_ops);
+CREATE INDEX index_meetings_on_country ON meetings(meeting_country);
+CREATE INDEX index_import_runs_on_kind ON import_runs(run_kind, run_id);
+CREATE INDEX index_import_run_changes_on_run ON import_run_changes(run_id, change_key);
+CREATE INDEX index_organizations_on_deregistered_at ON organizations(organization_deregistered_at);
+CREATE INDEX index_organizations_on_category ON organizations(organization_category, organization_subsection);
+CREATE INDEX index_organization_interests_on_name ON organization_interests(interest_name);
+CREATE INDEX index_meeting_topics_on_name_trigram ON meeting_topics USING GIN(topic_name gin_trgm_ops);
+CREATE INDEX index_unregistered_entities_meetings_on_meeting ON unregistered_entities_meetings(meeting_id);
+CREATE INDEX index_pending_organizations_meetings_on_meeting ON pending_organizations_meetings(meeting_id);
 
 -- Trigger that inserts updated records into organizations_history.
 CREATE OR REPLACE FUNCTION fn_organizations_history() RETURNS TRIGGER AS $BODY$
   BEGIN
     IF NEW.organization_updated_at > OLD.organization_updated_at THEN
-      INSERT INTO organizations_history VALUES(
+      INSERT INTO organizations_history (
+        organization_id,
+        organization_name,
+        organization_country,
+        organization_legal_status,
+        organization_updated_at,
+        organization_registered_at,
+        organization_category,
+        organization_subsection,
+        organization_goals,
+        organization_website,
+        organization_address,
+        organization_post_code,
+        organization_city,
+        organization_persons,
+        organization_persons_fte
+      ) VALUES (
         OLD.organization_id,
         OLD.organization_name,
         OLD.organization_country,
         OLD.organization_legal_status,
         OLD.organization_updated_at,
-        OLD.organization_registered_at
+        OLD.organization_registered_at,
+        OLD.organization_category,
+        OLD.organization_subsection,
+        OLD.organization_goals,
+        OLD.organization_website,
+        OLD.organization_address,
+        OLD.organization_post_code,
+        OLD.organization_city,
+        OLD.organization_persons,
+        OLD.organization_persons_fte
       );
     END IF;
     RETURN NEW;
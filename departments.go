@@ -1,18 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"path/filepath"
 )
 
 type department struct {
-	Name         string   `json:"name"`
-	Abbreviation string   `json:"abbreviation"`
-	Description  string   `json:"description"`
-	Leaders      []leader `json:"leaders"`
-	Members      []member `json:"members"`
+	Name           string   `json:"name"`
+	Abbreviation   string   `json:"abbreviation"`
+	Description    string   `json:"description"`
+	MatchThreshold float64  `json:"matchThreshold,omitempty"`
+	Leaders        []leader `json:"leaders"`
+	Members        []member `json:"members"`
 }
 
 type leader struct {
@@ -25,9 +29,10 @@ type leader struct {
 }
 
 type member struct {
-	ID    *string `json:"id"`
-	Name  string  `json:"name"`
-	Roles []struct {
+	ID      *string  `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Roles   []struct {
 		Leader *string `json:"leader"`
 		Role   string  `json:"role"`
 	} `json:"roles"`
@@ -61,6 +66,39 @@ func countryCodeToID(db *sql.DB) (map[string]int, error) {
 	return countries, nil
 }
 
+// Read the department in a JSON file.
+func readDepartment(path string) (department, error) {
+	var dep department
+
+	// Read file data.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return dep, err
+	}
+
+	// Unmarshal file data into dep variable.
+	if err := json.Unmarshal(data, &dep); err != nil {
+		return dep, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	return dep, nil
+}
+
+// Write a department to a JSON file, indented like the files in database/departments.
+func writeDepartment(path string, dep department) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(dep); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
 func forEachDepartment(dir string, fn func(dep department) error) error {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -68,40 +106,45 @@ func forEachDepartment(dir string, fn func(dep department) error) error {
 	}
 
 	for _, file := range files {
-		var dep department
-
-		// Read file data.
-		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		dep, err := readDepartment(filepath.Join(dir, file.Name()))
 		if err != nil {
 			return err
 		}
 
-		// Unmarshal file data into dep variable.
-		if err := json.Unmarshal(data, &dep); err != nil {
+		// Apply function to each department.
+		if err := fn(dep); err != nil {
 			return err
 		}
-
-		// Apply function to each department.
-		fn(dep)
 	}
 	return nil
 }
 
-// Upsert the contents of each department into the database.
-func upsertDepartments(db *sql.DB) error {
+// Upsert the contents of each department in dir into the database.
+func upsertDepartments(dir string, db *sql.DB, run *importRun, dryRun bool) error {
 	countries, err := countryCodeToID(db)
 	if err != nil {
 		return err
 	}
 
-	err = forEachDepartment(filepath.Join("database", "departments"), func(dep department) error {
+	err = forEachDepartment(dir, func(dep department) error {
+		if dryRun {
+			log.Printf(
+				"dry run, would upsert %s with %d leaders and %d members\n",
+				dep.Abbreviation, len(dep.Leaders), len(dep.Members),
+			)
+			return nil
+		}
+
 		// Upsert departments.
-		_, err := db.Exec(`
+		err := upsertRow(db, run, "department "+dep.Abbreviation, `
             INSERT INTO departments (department_abbreviation, department_name, department_description)
             VALUES ($1, $2, $3)
             ON CONFLICT (department_abbreviation) DO UPDATE SET
                 department_name = EXCLUDED.department_name,
-                department_description = EXCLUDED.department_description`,
+                department_description = EXCLUDED.department_description
+            WHERE (departments.department_name, departments.department_description)
+                IS DISTINCT FROM (EXCLUDED.department_name, EXCLUDED.department_description)
+            RETURNING xmax = 0`,
 			dep.Abbreviation, dep.Name, dep.Description,
 		)
 		if err != nil {
@@ -116,14 +159,17 @@ func upsertDepartments(db *sql.DB) error {
 				country = id
 			}
 
-			_, err := db.Exec(`
+			err := upsertRow(db, run, "leader "+*leader.ID, `
                 INSERT INTO leaders (leader_id, leader_name, leader_role, leader_country, leader_department)
                 VALUES ($1, $2, $3, $4, $5)
                 ON CONFLICT (leader_id) DO UPDATE SET
                     leader_name = EXCLUDED.leader_name,
                     leader_role = EXCLUDED.leader_role,
                     leader_country = EXCLUDED.leader_country,
-                    leader_department = EXCLUDED.leader_department`,
+                    leader_department = EXCLUDED.leader_department
+                WHERE (leaders.leader_name, leaders.leader_role, leaders.leader_country, leaders.leader_department)
+                    IS DISTINCT FROM (EXCLUDED.leader_name, EXCLUDED.leader_role, EXCLUDED.leader_country, EXCLUDED.leader_department)
+                RETURNING xmax = 0`,
 				*leader.ID, leader.Name, leader.Role, country, dep.Abbreviation,
 			)
 			if err != nil {
@@ -133,11 +179,13 @@ func upsertDepartments(db *sql.DB) error {
 
 		// Upsert all members.
 		for _, member := range dep.Members {
-			_, err := db.Exec(`
+			err := upsertRow(db, run, "member "+*member.ID, `
                 INSERT INTO members (member_id, member_name)
                 VALUES ($1, $2)
                 ON CONFLICT (member_id) DO UPDATE SET
-                    member_name = EXCLUDED.member_name`,
+                    member_name = EXCLUDED.member_name
+                WHERE members.member_name IS DISTINCT FROM EXCLUDED.member_name
+                RETURNING xmax = 0`,
 				*member.ID, member.Name,
 			)
 			if err != nil {
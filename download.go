@@ -1,78 +1,433 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"log"
 	"math"
 	"math/bits"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-func downloadFile(src, dst string) error {
-	out, err := os.Create(dst)
+// Returned when another process is downloading to the same path.
+var errLocked = errors.New("locked by another process")
+
+// What identifies a version of a source: the ETag and Last-Modified headers
+// of its response, and the SHA-256 of its content.
+type validators struct {
+	etag         string
+	lastModified string
+	sha256       string
+}
+
+// The body of a source that is being read, which is also written to a file
+// if one was given. It keeps a SHA-256 of what was read.
+type source struct {
+	body io.ReadCloser
+	r    io.Reader
+	hash hash.Hash
+	file *os.File
+	read int64
+	eof  bool
+
+	progress *progress
+	lock     io.Closer // Held on the path while the source is open.
+	archive  *archive  // Archives the body once it is complete, if not nil.
+	url      string
+
+	// Length of the body according to the server, or -1 if unknown.
+	length int64
+	// Path the body is written to, which it is renamed to from a ".part" file
+	// once it is complete.
+	path string
+
+	validators
+	notModified bool // The server responded with 304 Not Modified.
+	spooled     bool // The body was written to disk before it is read.
+	temp        bool // The path is in the cache, and removed on Close.
+}
+
+// Fetch src and return its body, so it can be decoded while it downloads. If
+// dst is not empty, the body is also written to dst as it is read.
+//
+// The request is conditional on the validators of the previous version. If
+// the previous version has a checksum, the body is first written to dst, or
+// to a file in the user's cache directory, so it can be compared before it is
+// decoded. Downloads to disk go to a ".part" file first, which is resumed with
+// a Range request if an earlier download was interrupted. The path is locked
+// until the source is closed, so runs at the same time do not write to the
+// same file. If a is not nil, the body is archived once it is complete, also
+// if it was resumed.
+func openSource(f Fetcher, a *archive, src, dst string, prev validators) (*source, error) {
+	log.Printf("starting download: %s\n", src)
+
+	s := &source{hash: sha256.New(), path: dst, spooled: prev.sha256 != "", archive: a, url: src}
+
+	if dst == "" {
+		name, err := fixtureName(src)
+		if err != nil {
+			return nil, err
+		}
+
+		cache, err := cacheDir()
+		if err != nil {
+			return nil, err
+		}
+
+		s.path = filepath.Join(cache, name)
+		s.temp = true
+	}
+
+	lock, err := lockFile(s.path + ".lock")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("could not lock %s: %v", s.path, err)
 	}
 
-	defer out.Close()
+	s.lock = lock
 
-	log.Printf("starting download: %s\n", src)
+	// Allow for releasing the lock if the source is not returned.
+	success := false
+
+	defer func() {
+		if !success {
+			s.unlock()
+		}
+	}()
+
+	header := http.Header{}
+
+	if prev.etag != "" {
+		header.Set("If-None-Match", prev.etag)
+	}
+
+	if prev.lastModified != "" {
+		header.Set("If-Modified-Since", prev.lastModified)
+	}
+
+	// Resume an interrupted download, but only if it is of the same version.
+	offset, version := partial(s.path)
+
+	if offset > 0 && version != "" {
+		log.Printf("resuming download at %s\n", humanBytes(uint64(offset)))
+
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		header.Set("If-Range", version)
+		s.spooled = true
+	}
+
+	res, err := f.Fetch(src, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		log.Printf("not modified: %s\n", src)
+
+		return &source{body: http.NoBody, r: http.NoBody, validators: prev, notModified: true}, nil
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, fmt.Errorf("bad response from server: %s", res.Status)
+	}
+
+	s.body = res.Body
+	s.etag = res.Header.Get("ETag")
+	s.lastModified = res.Header.Get("Last-Modified")
+	s.length = res.ContentLength
+
+	if s.spooled {
+		err := s.spool(res, offset)
+		res.Body.Close()
+
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+
+		success = true
+
+		return s, nil
+	}
+
+	if s.archive != nil {
+		s.archive.wrap(src, res)
+		s.body = res.Body
+	}
 
-	done := make(chan int64)
+	s.progress = newProgress(os.Stderr, 0, s.length)
 
-	go printDownloadPercent(done, dst)
+	if dst == "" {
+		s.r = io.TeeReader(res.Body, io.MultiWriter(s.hash, s.progress))
+		success = true
+
+		return s, nil
+	}
 
-	res, err := http.Get(src)
+	s.file, err = s.createPart()
 	if err != nil {
+		s.stopProgress()
+		res.Body.Close()
+		return nil, err
+	}
+
+	s.r = io.TeeReader(res.Body, io.MultiWriter(s.hash, s.file, s.progress))
+	success = true
+
+	return s, nil
+}
+
+// Returns the directory that downloads are spooled to, which is created if it
+// does not exist. It is in the user's cache directory rather than the shared
+// temporary directory, where other users can create a file before it is
+// written.
+func cacheDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	cache = filepath.Join(cache, "eu_transparency")
+
+	return cache, os.MkdirAll(cache, 0700)
+}
+
+func (s *source) unlock() {
+	if s.lock != nil {
+		s.lock.Close()
+		s.lock = nil
+	}
+}
+
+// Returns the size of the ".part" file of path, and the ETag or Last-Modified
+// of the version it is a part of.
+func partial(path string) (int64, string) {
+	fi, err := os.Stat(path + ".part")
+	if err != nil {
+		return 0, ""
+	}
+
+	version, err := ioutil.ReadFile(path + ".part.version")
+	if err != nil {
+		return 0, ""
+	}
+
+	return fi.Size(), strings.TrimSpace(string(version))
+}
+
+// Create the ".part" file of the source, next to a file with its version, so
+// that it can be resumed.
+func (s *source) createPart() (*os.File, error) {
+	version := s.etag
+	if version == "" {
+		version = s.lastModified
+	}
+
+	// Without a version, a resumed download could mix two versions.
+	os.Remove(s.path + ".part.version")
+
+	if version != "" {
+		if err := ioutil.WriteFile(s.path+".part.version", []byte(version), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return os.Create(s.path + ".part")
+}
+
+// Rename the ".part" file into place if it has the length the server sent.
+func (s *source) completePart(size int64) error {
+	if s.length >= 0 && size != s.length {
+		return fmt.Errorf("incomplete download, got %d of %d bytes", size, s.length)
+	}
+
+	if err := os.Rename(s.path+".part", s.path); err != nil {
 		return err
 	}
 
-	defer res.Body.Close()
+	os.Remove(s.path + ".part.version")
+
+	return nil
+}
 
-	n, err := io.Copy(out, res.Body)
+// Write the whole body to disk, appending to the ".part" file if the server
+// responded with the range that starts at offset, and continue reading from
+// the complete file.
+func (s *source) spool(res *http.Response, offset int64) error {
+	var file *os.File
+	var err error
+
+	if res.StatusCode == http.StatusPartialContent {
+		start, total, err := contentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+
+		if start != offset {
+			return fmt.Errorf("server resumed at byte %d instead of %d", start, offset)
+		}
+
+		file, err = os.OpenFile(s.path+".part", os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+
+		// The checksum covers what was downloaded before.
+		if _, err := io.Copy(s.hash, file); err != nil {
+			file.Close()
+			return err
+		}
+
+		s.length = total
+	} else {
+		offset = 0
+
+		file, err = s.createPart()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.body, s.r = file, file
+
+	p := newProgress(os.Stderr, offset, s.length)
+
+	n, err := io.Copy(io.MultiWriter(file, s.hash, p), res.Body)
+	p.Stop()
 	if err != nil {
 		return err
 	}
 
-	done <- n
+	log.Printf("finished download: %s\n", humanBytes(uint64(offset+n)))
+
+	if err := s.completePart(offset + n); err != nil {
+		return err
+	}
+
+	s.sha256 = hex.EncodeToString(s.hash.Sum(nil))
 
-	log.Printf("finished download: %s\n", dst)
+	// The complete file, rather than the response, which may be only the
+	// rest of it.
+	if s.archive != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
 
-	return nil
+		s.archive.store(s.url, res.Header.Get("Content-Type"), file)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+
+	return err
+}
+
+// Parses a Content-Range header such as "bytes 1000-1999/2000" into the
+// first byte and the total length, which is -1 if unknown.
+func contentRange(val string) (int64, int64, error) {
+	var start, end int64
+	var total string
+
+	if _, err := fmt.Sscanf(val, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", val)
+	}
+
+	if total == "*" {
+		return start, -1, nil
+	}
+
+	length, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", val)
+	}
+
+	return start, length, nil
 }
 
-func printDownloadPercent(done chan int64, path string) {
-	var stop = false
+// Returns whether the source is the same as the previous version, either
+// because the server said so or because the checksum is the same.
+func (s *source) unchanged(prev validators) bool {
+	return s.notModified || (prev.sha256 != "" && s.sha256 == prev.sha256)
+}
 
-	for {
-		select {
-		case <-done:
-			stop = true
-		default:
-			file, err := os.Open(path)
-			if err != nil {
-				log.Fatal(err)
-			}
+func (s *source) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.read += int64(n)
 
-			fi, err := file.Stat()
-			if err != nil {
-				log.Fatal(err)
-			}
+	if err == io.EOF {
+		s.eof = true
 
-			size := fi.Size()
+		// Stop the bar before the caller logs anything after the download.
+		s.stopProgress()
+	}
+
+	return n, err
+}
 
-			// Return and rewrite the download status in a human readable form.
-			fmt.Printf("\rDownloaded %s", humanBytes(uint64(size)))
+// Stop reporting the progress of a streaming download, if it was not stopped
+// yet.
+func (s *source) stopProgress() {
+	if s.progress != nil {
+		s.progress.Stop()
+		s.progress = nil
+	}
+}
+
+// Returns the SHA-256 of the source. Anything that was not read yet, such as
+// whitespace after the root element, is read first.
+func (s *source) Sum() (string, error) {
+	if s.sha256 != "" {
+		return s.sha256, nil
+	}
+
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		return "", err
+	}
+
+	s.sha256 = hex.EncodeToString(s.hash.Sum(nil))
+
+	return s.sha256, nil
+}
+
+// Close the source. A body that was written to disk while it was read is only
+// renamed into place if it was read completely, otherwise its ".part" file is
+// kept to resume from.
+func (s *source) Close() error {
+	err := s.body.Close()
+
+	// If the source is closed before it was read completely.
+	s.stopProgress()
+
+	if s.file != nil {
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
 		}
 
-		if stop {
-			// Add a newline once the download finishes.
-			fmt.Printf("\n")
-			break
+		if s.eof && err == nil {
+			err = s.completePart(s.read)
 		}
 	}
+
+	if s.temp && s.spooled {
+		os.Remove(s.path)
+	}
+
+	if !s.spooled && !s.notModified {
+		log.Printf("finished download: %s\n", humanBytes(uint64(s.read)))
+	}
+
+	s.unlock()
+
+	return err
 }
 
 // Convert bytes to a human readable format.
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// Sources without a destination are spooled to the user's cache.
+	_, restore := tempCache(t)
+	defer restore()
+
+	err = ioutil.WriteFile(filepath.Join(dir, "example.com_register.xml"), []byte(registerXML), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fileFetcher{dir}
+
+	t.Run("tee", func(t *testing.T) {
+		dst := filepath.Join(dir, "register.xml")
+
+		src, err := openSource(f, nil, "http://example.com/register.xml", dst, validators{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(src)
+
+		// So that nothing is logged while the bar is drawn.
+		if src.progress != nil {
+			t.Error("expected the progress to stop at the end of the body")
+		}
+
+		sum, err := src.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := fmt.Sprintf("%x", sha256.Sum256([]byte(registerXML))); sum != expected {
+			t.Errorf("expected SHA-256 to be %s, got %s", expected, sum)
+		}
+
+		if err := src.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		written, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != registerXML || string(written) != registerXML {
+			t.Errorf("expected the body and %s to be the register, got %d and %d bytes", dst, len(body), len(written))
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := openSource(f, nil, "http://example.com/other.xml", "", validators{}); err == nil {
+			t.Errorf("expected an error for a missing source, got nil")
+		}
+	})
+
+	t.Run("conditional", func(t *testing.T) {
+		first, err := openSource(f, nil, "http://example.com/register.xml", "", validators{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first.Close()
+
+		tests := map[string]struct {
+			prev     validators
+			expected bool
+		}{
+			"etag":          {validators{etag: first.etag}, true},
+			"last modified": {validators{lastModified: first.lastModified}, true},
+			"same checksum": {validators{etag: `"other"`, sha256: fmt.Sprintf("%x", sha256.Sum256([]byte(registerXML)))}, true},
+			"other etag":    {validators{etag: `"other"`}, false},
+			"other sum":     {validators{etag: `"other"`, sha256: "0123"}, false},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				src, err := openSource(f, nil, "http://example.com/register.xml", "", test.prev)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer src.Close()
+
+				if output := src.unchanged(test.prev); output != test.expected {
+					t.Errorf("expected unchanged to be %t, got %t", test.expected, output)
+				}
+
+				body, _ := ioutil.ReadAll(src)
+
+				if !test.expected && string(body) != registerXML {
+					t.Errorf("expected the register to be read, got %d bytes", len(body))
+				}
+			})
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		first, err := openSource(f, nil, "http://example.com/register.xml", "", validators{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first.Close()
+
+		tests := map[string]struct {
+			version string
+			offset  int
+		}{
+			"same version":  {first.etag, 100},
+			"other version": {`"other"`, 100},
+			"no version":    {"", 100},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				dst := filepath.Join(dir, "resumed.xml")
+
+				defer os.Remove(dst)
+
+				// An earlier download that was interrupted, with different
+				// content so that a restarted download can be told apart.
+				part := strings.Repeat("x", test.offset)
+				if test.version == first.etag {
+					part = registerXML[:test.offset]
+				}
+
+				if err := ioutil.WriteFile(dst+".part", []byte(part), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				if test.version != "" {
+					if err := ioutil.WriteFile(dst+".part.version", []byte(test.version), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				a := newArchive(filepath.Join(dir, "archive", name))
+
+				src, err := openSource(f, a, "http://example.com/register.xml", dst, validators{sha256: "0123"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				body, _ := ioutil.ReadAll(src)
+				src.Close()
+
+				written, err := ioutil.ReadFile(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(body) != registerXML || string(written) != registerXML {
+					t.Errorf("expected the body and %s to be the register, got %d and %d bytes", dst, len(body), len(written))
+				}
+
+				if expected := fmt.Sprintf("%x", sha256.Sum256([]byte(registerXML))); src.sha256 != expected {
+					t.Errorf("expected SHA-256 to be %s, got %s", expected, src.sha256)
+				}
+
+				if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+					t.Errorf("expected %s.part to be renamed, got %v", dst, err)
+				}
+
+				// The whole register, rather than only the rest of it.
+				snaps, err := a.snapshots()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(snaps) != 1 || snaps[0].SHA256 != src.sha256 {
+					t.Errorf("expected a snapshot of the register, got %+v", snaps)
+				}
+			})
+		}
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		dst := filepath.Join(dir, "locked.xml")
+
+		first, err := openSource(f, nil, "http://example.com/register.xml", dst, validators{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := openSource(f, nil, "http://example.com/register.xml", dst, validators{}); err == nil {
+			t.Errorf("expected an error while %s is locked, got nil", dst)
+		}
+
+		first.Close()
+
+		second, err := openSource(f, nil, "http://example.com/register.xml", dst, validators{})
+		if err != nil {
+			t.Errorf("expected the lock to be released on Close, got %v", err)
+		} else {
+			second.Close()
+		}
+
+		if _, err := os.Stat(dst + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("expected %s.lock to be removed, got %v", dst, err)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		dst := filepath.Join(dir, "interrupted.xml")
+
+		src, err := openSource(f, nil, "http://example.com/register.xml", dst, validators{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The import stopped before the end of the register.
+		src.Read(make([]byte, 100))
+		src.Close()
+
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Errorf("expected %s to not exist, got %v", dst, err)
+		}
+
+		if offset, version := partial(dst); offset == 0 || version == "" {
+			t.Errorf("expected a part to resume, got %d bytes of version %q", offset, version)
+		}
+	})
+}
+
+func TestContentRange(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		start int64
+		total int64
+		valid bool
+	}{
+		"range":          {"bytes 1000-1999/2000", 1000, 2000, true},
+		"unknown length": {"bytes 1000-1999/*", 1000, -1, true},
+		"invalid":        {"items 0-1/2", 0, 0, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			start, total, err := contentRange(test.input)
+			if (err == nil) != test.valid || start != test.start || total != test.total {
+				t.Errorf("expected %q to be %d of %d, got %d of %d (%v)", test.input, test.start, test.total, start, total, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+)
+
+// A suggested organization in the register for an unregistered entity.
+type entityMatch struct {
+	entityID         int
+	entityName       string
+	organizationID   string
+	organizationName string
+	score            float64
+}
+
+// Match the names of unregistered entities against the names of organizations
+// in the register with pg_trgm, and store the most similar organization with a
+// similarity of at least threshold as a suggestion. Entities are matched again
+// on each run, as organizations can join the register after their meetings.
+func matchEntities(db *sql.DB, threshold float64, dryRun bool) error {
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	// The % operator, which can use the trigram index, compares against the
+	// similarity threshold of the session. It is only set for this transaction.
+	_, err = txn.Exec(`SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, strconv.FormatFloat(threshold, 'f', -1, 64))
+	if err != nil {
+		return err
+	}
+
+	rows, err := txn.Query(`
+		SELECT unregistered_entities.entity_id, unregistered_entities.entity_name,
+			COALESCE(candidates.organization_id, ''), COALESCE(candidates.organization_name, ''),
+			COALESCE(similarity(unregistered_entities.entity_name, candidates.organization_name), 0)
+		FROM unregistered_entities
+		LEFT JOIN LATERAL (
+			SELECT organization_id, organization_name
+			FROM organizations
+			WHERE organization_name % unregistered_entities.entity_name
+			ORDER BY organization_name <-> unregistered_entities.entity_name
+			LIMIT 1
+		) candidates ON TRUE
+		ORDER BY unregistered_entities.entity_name
+	`)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	matches := []entityMatch{}
+
+	for rows.Next() {
+		var m entityMatch
+
+		if err := rows.Scan(&m.entityID, &m.entityName, &m.organizationID, &m.organizationName, &m.score); err != nil {
+			return err
+		}
+
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var matched int
+
+	for _, m := range matches {
+		var organizationID *string
+		var score *float64
+
+		if m.organizationID != "" {
+			log.Printf("%q matches %q (%s), score %.2f\n", m.entityName, m.organizationName, m.organizationID, m.score)
+
+			organizationID, score = &m.organizationID, &m.score
+			matched++
+		}
+
+		if dryRun {
+			continue
+		}
+
+		_, err := txn.Exec(`
+			UPDATE unregistered_entities SET
+				entity_organization_id = $2,
+				entity_match_score = $3,
+				entity_matched_at = now()
+			WHERE entity_id = $1`,
+			m.entityID, organizationID, score,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		log.Printf("dry run, would store %d matches for %d unregistered entities\n", matched, len(matches))
+		return nil
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	success = true
+
+	log.Printf("matched %d of %d unregistered entities\n", matched, len(matches))
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultUserAgent = "eu_transparency (+https://github.com/imjasonmiller/eu_transparency)"
+
+// A Fetcher retrieves the resource at a URL, with optional request headers
+// such as If-None-Match. The caller closes the body.
+type Fetcher interface {
+	Fetch(url string, header http.Header) (*http.Response, error)
+}
+
+type httpFetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+// Returns a fetcher that uses HTTP. The timeout applies to connecting and
+// waiting for the response headers, not to reading the body, as the register
+// can take a while to download. Proxies are taken from the environment.
+func newHTTPFetcher(timeout time.Duration, userAgent string) *httpFetcher {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   4,
+	}
+
+	return &httpFetcher{
+		client:    &http.Client{Transport: transport},
+		userAgent: userAgent,
+	}
+}
+
+func (f *httpFetcher) Fetch(url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("User-Agent", f.userAgent)
+
+	return f.client.Do(req)
+}
+
+// A fetcher that serves recorded responses from a directory, see fixtureName.
+// URLs without a recording result in a 404 Not Found. Recordings have an ETag
+// and Last-Modified based on their file, which conditional and range requests
+// compare.
+type fileFetcher struct {
+	dir string
+}
+
+func (f *fileFetcher) Fetch(u string, header http.Header) (*http.Response, error) {
+	name, err := fixtureName(u)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(f.dir, name))
+	if os.IsNotExist(err) {
+		return fixtureResponse(http.StatusNotFound, http.NoBody, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+	modified := fi.ModTime().UTC().Format(http.TimeFormat)
+
+	// A matching ETag takes precedence over the modification time.
+	notModified := header.Get("If-None-Match") == etag
+	if since, err := http.ParseTime(header.Get("If-Modified-Since")); err == nil && header.Get("If-None-Match") == "" {
+		notModified = !fi.ModTime().Truncate(time.Second).After(since)
+	}
+
+	res := fixtureResponse(http.StatusOK, file, fi.Size())
+
+	// Only ranges with an open end are served, as downloads are resumed with
+	// those. If-Range only matches the ETag.
+	var start int64
+	if _, err := fmt.Sscanf(header.Get("Range"), "bytes=%d-", &start); err == nil && start < fi.Size() {
+		if ifRange := header.Get("If-Range"); ifRange == "" || ifRange == etag {
+			if _, err := file.Seek(start, io.SeekStart); err != nil {
+				file.Close()
+				return nil, err
+			}
+
+			res = fixtureResponse(http.StatusPartialContent, file, fi.Size()-start)
+			res.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, fi.Size()-1, fi.Size()))
+		}
+	}
+
+	if notModified {
+		file.Close()
+		res = fixtureResponse(http.StatusNotModified, http.NoBody, 0)
+	}
+
+	res.Header.Set("ETag", etag)
+	res.Header.Set("Last-Modified", modified)
+
+	return res, nil
+}
+
+func fixtureResponse(status int, body io.ReadCloser, size int64) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          body,
+		ContentLength: size,
+	}
+}
+
+var fixtureUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Returns the file name a URL is recorded under. The scheme is dropped and
+// every run of other characters is replaced by an underscore, for example
+// "ec.europa.eu_transparencyinitiative_meetings_meeting.do_host_829436d0-...".
+func fixtureName(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+
+	parsed.Scheme = ""
+
+	return fixtureUnsafe.ReplaceAllString(strings.TrimPrefix(parsed.String(), "//"), "_"), nil
+}
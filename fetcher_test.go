@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := map[string]struct {
+		url      string
+		expected string
+	}{
+		"meetings": {
+			"http://ec.europa.eu/transparencyinitiative/meetings/meeting.do?host=829436d0-1850-424f-aebe-6dd76c793be2",
+			"ec.europa.eu_transparencyinitiative_meetings_meeting.do_host_829436d0-1850-424f-aebe-6dd76c793be2",
+		},
+		"register": {
+			"http://ec.europa.eu/transparencyregister/public/consultation/statistics.do?action=getLobbyistsXml&fileType=NEW",
+			"ec.europa.eu_transparencyregister_public_consultation_statistics.do_action_getLobbyistsXml_fileType_NEW",
+		},
+		"https": {"https://ec.europa.eu/index.html", "ec.europa.eu_index.html"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output, err := fixtureName(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output != test.expected {
+				t.Errorf("expected %s to be %s, got %s", test.url, test.expected, output)
+			}
+		})
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "example.com_page.html"), []byte("<html></html>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fileFetcher{dir}
+
+	t.Run("recorded", func(t *testing.T) {
+		res, err := f.Fetch("http://example.com/page.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+
+		body, _ := ioutil.ReadAll(res.Body)
+
+		if res.StatusCode != http.StatusOK || string(body) != "<html></html>" || res.ContentLength != 13 {
+			t.Errorf("expected the recorded page, got %s with %q", res.Status, body)
+		}
+	})
+
+	t.Run("not recorded", func(t *testing.T) {
+		res, err := f.Fetch("http://example.com/other.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected %d, got %s", http.StatusNotFound, res.Status)
+		}
+	})
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent()))
+	}))
+
+	defer srv.Close()
+
+	res, err := newHTTPFetcher(time.Second, "test-agent").Fetch(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+
+	if string(body) != "test-agent" {
+		t.Errorf("expected User-Agent to be test-agent, got %q", body)
+	}
+}
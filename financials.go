@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A financial year of an organization, as stored in organization_financials.
+// Amounts that were not declared or could not be parsed are nil.
+type financialYear struct {
+	year       int
+	start      string
+	end        string
+	costsLower *float64
+	costsUpper *float64
+	grants     *float64
+	other      *float64
+}
+
+// Returns the financial year that an organization declared, and false if it
+// did not declare a closed year.
+func declaredYear(f financialData) (financialYear, bool, error) {
+	end := strings.TrimSpace(f.ClosedYear.EndDate)
+	if len(end) < 4 {
+		return financialYear{}, false, nil
+	}
+
+	year, err := strconv.Atoi(end[:4])
+	if err != nil {
+		return financialYear{}, false, fmt.Errorf("invalid closed year %q", end)
+	}
+
+	fy := financialYear{year: year, start: f.ClosedYear.StartDate, end: end}
+
+	if fy.costsLower, fy.costsUpper, err = parseAmountRange(f.Costs); err != nil {
+		return fy, true, fmt.Errorf("costs: %v", err)
+	}
+
+	if fy.grants, err = parseAmount(f.Grants); err != nil {
+		return fy, true, fmt.Errorf("grants: %v", err)
+	}
+
+	if fy.other, err = parseAmount(f.Other); err != nil {
+		return fy, true, fmt.Errorf("other sources: %v", err)
+	}
+
+	return fy, true, nil
+}
+
+// Parses a declared amount or range of amounts in euros into its lower and
+// upper bound, such as "100 000 € - 199 999 €", "< 9 999 €" or ">= 10000000".
+// An open bound is nil, as are both bounds of an empty string.
+func parseAmountRange(s string) (*float64, *float64, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == "":
+		return nil, nil, nil
+	case strings.HasPrefix(s, "<"):
+		upper, err := parseAmount(strings.TrimLeft(s, "<="))
+		zero := 0.0
+		return &zero, upper, err
+	case strings.HasPrefix(s, ">"):
+		lower, err := parseAmount(strings.TrimLeft(s, ">="))
+		return lower, nil, err
+	case strings.HasSuffix(s, "+"):
+		lower, err := parseAmount(strings.TrimSuffix(s, "+"))
+		return lower, nil, err
+	}
+
+	// A hyphen that separates two amounts, rather than a minus sign.
+	if parts := regexp.MustCompile(`\d\s*[€]?\s*-\s*[€]?\s*\d`).FindStringIndex(s); parts != nil {
+		split := parts[0] + strings.Index(s[parts[0]:parts[1]], "-")
+
+		lower, err := parseAmount(s[:split])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		upper, err := parseAmount(s[split+1:])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return lower, upper, nil
+	}
+
+	amount, err := parseAmount(s)
+	return amount, amount, err
+}
+
+// Parses an amount in euros, such as "1 250 000 €", "1.250.000,00" or
+// "1250000.0". It returns nil for an empty string.
+func parseAmount(s string) (*float64, error) {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '-':
+			return r
+		}
+		return -1
+	}, s)
+
+	if clean == "" {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no amount in %q", s)
+	}
+
+	// The last separator is a decimal separator if it has one or two digits
+	// after it, otherwise all separators group thousands.
+	last := strings.LastIndexAny(clean, ".,")
+	if last != -1 && len(clean)-last-1 <= 2 {
+		clean = strings.NewReplacer(".", "", ",", "").Replace(clean[:last]) + "." + clean[last+1:]
+	} else {
+		clean = strings.NewReplacer(".", "", ",", "").Replace(clean)
+	}
+
+	amount, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+
+	return &amount, nil
+}
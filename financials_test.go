@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Formats an optional amount, with "nil" for an open bound.
+func formatAmount(amount *float64) string {
+	if amount == nil {
+		return "nil"
+	}
+
+	return fmt.Sprintf("%g", *amount)
+}
+
+func TestParseAmountRange(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"empty":            {"", "nil-nil"},
+		"range":            {"6000000 - 6249999", "6e+06-6.249999e+06"},
+		"euro signs":       {"100 000 € - 199 999 €", "100000-199999"},
+		"no spaces":        {"10000-24999", "10000-24999"},
+		"less than":        {"< 9 999 €", "0-9999"},
+		"at most":          {"<= 9999", "0-9999"},
+		"at least":         {">= 10 000 000 €", "1e+07-nil"},
+		"plus":             {"10000000+", "1e+07-nil"},
+		"amount":           {"25000", "25000-25000"},
+		"decimal point":    {"1250000.0", "1.25e+06-1.25e+06"},
+		"decimal comma":    {"1.250.000,50", "1.2500005e+06-1.2500005e+06"},
+		"thousands commas": {"1,250,000", "1.25e+06-1.25e+06"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			lower, upper, err := parseAmountRange(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output := formatAmount(lower) + "-" + formatAmount(upper); output != test.expected {
+				t.Errorf("expected %q to be %s, got %s", test.input, test.expected, output)
+			}
+		})
+	}
+}
+
+func TestParseAmountInvalid(t *testing.T) {
+	if _, err := parseAmount("not declared"); err == nil {
+		t.Errorf("expected an error for an amount without digits, got nil")
+	}
+}
+
+func TestDeclaredYear(t *testing.T) {
+	var f financialData
+
+	f.ClosedYear.StartDate = "2017-01-01T00:00:00.000+01:00"
+	f.ClosedYear.EndDate = "2017-12-31T00:00:00.000+01:00"
+	f.Costs = "6000000 - 6249999"
+	f.Grants = "0"
+
+	fy, ok, err := declaredYear(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || fy.year != 2017 || formatAmount(fy.costsUpper) != "6.249999e+06" || formatAmount(fy.grants) != "0" || fy.other != nil {
+		t.Errorf("expected the 2017 financial year, got %d with costs up to %s", fy.year, formatAmount(fy.costsUpper))
+	}
+
+	if _, ok, _ := declaredYear(financialData{}); ok {
+		t.Errorf("expected no financial year without a closed year, got one")
+	}
+}
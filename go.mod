@@ -7,5 +7,8 @@ require (
 	github.com/imjasonmiller/godice v0.1.2
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.0.0
+	github.com/ulikunitz/xz v0.5.17
 	golang.org/x/net v0.0.0-20180911220305-26e67e76b6c3
+	golang.org/x/sys v0.1.0
+	golang.org/x/text v0.3.7
 )
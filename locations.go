@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// A city in the gazetteer, with the names it is also known by.
+type city struct {
+	Name      string   `json:"name"`
+	Country   string   `json:"country"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Aliases   []string `json:"aliases"`
+}
+
+// A normalized meeting location. The country is an ISO 3166-1 alpha 2 code.
+// Either may be empty if the location could not be found.
+type place struct {
+	city    *city
+	country string
+}
+
+// An offline gazetteer, see database/gazetteer.json. It is combined with the
+// country_names table, which holds the names used by the register.
+type gazetteer struct {
+	cities    map[string]*city  // Cities by folded name or alias.
+	countries map[string]string // Country codes by folded name.
+}
+
+// Separates the parts of a location, as in "Berlaymont, Brussels (Belgium)".
+var locationSeparator = regexp.MustCompile(`[,;/()|]|\s+-\s+`)
+
+func loadGazetteer(path string, countryNames map[string]string) (*gazetteer, error) {
+	var data struct {
+		Cities    []*city           `json:"cities"`
+		Countries map[string]string `json:"countries"`
+	}
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	g := &gazetteer{
+		cities:    map[string]*city{},
+		countries: map[string]string{},
+	}
+
+	for _, c := range data.Cities {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			g.cities[foldName(name)] = c
+		}
+	}
+
+	for _, names := range []map[string]string{countryNames, data.Countries} {
+		for name, code := range names {
+			g.countries[foldName(name)] = code
+		}
+	}
+
+	return g, nil
+}
+
+// Find the city and country in a location. Each part of the location is
+// looked up, and the country of a city is used if no country is named.
+func (g *gazetteer) locate(location string) place {
+	var p place
+
+	for _, part := range locationSeparator.Split(location, -1) {
+		key := foldName(part)
+
+		if c, ok := g.cities[key]; ok && p.city == nil {
+			p.city = c
+			continue
+		}
+
+		if code, ok := g.countries[key]; ok && p.country == "" {
+			p.country = code
+		}
+	}
+
+	if p.country == "" && p.city != nil {
+		p.country = p.city.Country
+	}
+
+	return p
+}
+
+// Returns a map of country names to the corresponding ISO 3166-1 alpha 2 code.
+func countryNameToCode(db *sql.DB) (map[string]string, error) {
+	countries := map[string]string{}
+
+	rows, err := db.Query(`SELECT country_name, country_code FROM country_names`)
+	if err != nil {
+		return countries, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, code string
+
+		if err := rows.Scan(&name, &code); err != nil {
+			return countries, err
+		}
+
+		countries[name] = code
+	}
+	if err := rows.Err(); err != nil {
+		return countries, err
+	}
+
+	return countries, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGazetteer(t *testing.T) {
+	g, err := loadGazetteer(filepath.Join("database", "gazetteer.json"), map[string]string{
+		"BELGIUM":    "BE",
+		"FRANCE":     "FR",
+		"LUXEMBOURG": "LU",
+		"GERMANY":    "DE",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		location string
+		city     string
+		country  string
+	}{
+		"city":             {"Brussels", "Brussels", "BE"},
+		"alias":            {"Bruxelles", "Brussels", "BE"},
+		"city and country": {"Brussels, Belgium", "Brussels", "BE"},
+		"whitespace":       {"  Brussels,\n   Belgium ", "Brussels", "BE"},
+		"parentheses":      {"Strasbourg (France)", "Strasbourg", "FR"},
+		"building":         {"Berlaymont, Brussels", "Brussels", "BE"},
+		"accents and case": {"MÜNCHEN", "Munich", "DE"},
+		"city state":       {"Luxembourg", "Luxembourg", "LU"},
+		"native country":   {"Bruxelles, Belgique", "Brussels", "BE"},
+		"country":          {"Germany", "", "DE"},
+		"unknown":          {"Video conference", "", ""},
+		"empty":            {"", "", ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := g.locate(test.location)
+
+			var city string
+			if p.city != nil {
+				city = p.city.Name
+			}
+
+			if city != test.city || p.country != test.country {
+				t.Errorf("expected %q to be %q in %q, got %q in %q", test.location, test.city, test.country, city, p.country)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+type lockedFile struct {
+	*os.File
+}
+
+// Remove the file while it is still locked, and release the lock.
+func (l lockedFile) Close() error {
+	os.Remove(l.Name())
+
+	return l.File.Close()
+}
+
+// Take an exclusive lock on the file at path, which is created if it does not
+// exist. The lock is released on Close, which removes the file, or when the
+// process exits.
+func lockFile(path string) (io.Closer, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			file.Close()
+
+			if err == syscall.EWOULDBLOCK {
+				return nil, errLocked
+			}
+
+			return nil, err
+		}
+
+		// The process that held the lock may have removed the file after it
+		// was opened, in which case another process can lock a new file at
+		// path. Only the file that is at path counts.
+		opened, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(opened, current) {
+			return lockedFile{file}, nil
+		}
+
+		file.Close()
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+type lockedFile struct {
+	*os.File
+}
+
+// Release the lock and remove the file. Removing fails while another process
+// has the file open, which then keeps it.
+func (l lockedFile) Close() error {
+	windows.UnlockFileEx(windows.Handle(l.Fd()), 0, 1, 0, new(windows.Overlapped))
+
+	err := l.File.Close()
+	os.Remove(l.Name())
+
+	return err
+}
+
+// Take an exclusive lock on the file at path, which is created if it does not
+// exist. The lock is released on Close, or when the process exits.
+func lockFile(path string) (io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+
+	if err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, new(windows.Overlapped)); err != nil {
+		file.Close()
+
+		if err == windows.ERROR_LOCK_VIOLATION {
+			return nil, errLocked
+		}
+
+		return nil, err
+	}
+
+	return lockedFile{file}, nil
+}
@@ -1,52 +1,518 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
+const (
+	registerURL = "http://ec.europa.eu/transparencyregister/public/consultation/statistics.do?action=getLobbyistsXml&fileType=NEW"
+	meetingsURL = "http://ec.europa.eu"
+)
+
+// Flags shared by all commands.
+type options struct {
+	env       string
+	src       string
+	out       string
+	dryRun    bool
+	userAgent string
+	timeout   time.Duration
+	fixtures  string
+	archive   string
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"sync orgs", "download the lobbyist register and upsert all organizations", syncOrgs},
+	{"sync departments", "upsert the departments, leaders and members from JSON", syncDepartments},
+	{"scrape meetings", "scrape the meetings of all leaders and their members", scrapeMeetings},
+	{"review members", "resolve cabinet member names that could not be matched", reviewMembersCmd},
+	{"match entities", "suggest registered organizations for unregistered meeting entities", matchEntitiesCmd},
+	{"runs diff", "show what changed between two import runs", diffRunsCmd},
+	{"runs", "list recent import runs", listRunsCmd},
+	{"replay", "re-import the lobbyist register from an archived snapshot", replay},
+	{"archive prune", "remove archived snapshots past the retention period", pruneArchiveCmd},
+	{"backup", "write a compressed dump of the database", backup},
+	{"migrate", "apply pending database migrations", migrate},
+}
+
 func main() {
-	cfg, err := loadConfig(".env")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+
+		if err := cmd.run(args[len(words):]); err != nil {
+			log.Fatalf("%s: %v", cmd.name, err)
+		}
+
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.usage)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun \"%s <command> -h\" for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// Returns a flag set for a command, with the flags every command accepts.
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&opts.env, "env", ".env", "path to the environment file with the database config")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "do everything except writing to the database")
+
+	return fs, opts
+}
+
+// Add the flags of commands that fetch from the network.
+func (o *options) fetchFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.userAgent, "user-agent", defaultUserAgent, "User-Agent header sent with each request")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "timeout for connecting and receiving response headers")
+	fs.StringVar(&o.fixtures, "fixtures", "", "serve recorded responses from this directory instead of the network")
+	fs.StringVar(&o.archive, "archive", filepath.Join("database", "archive"), "directory every downloaded response is archived in, empty to not archive")
+}
+
+// Returns the fetcher for the flags, which archives every response.
+func (o *options) fetcher() Fetcher {
+	f := o.unarchivedFetcher()
+
+	if a := o.archiver(); a != nil {
+		return &archivingFetcher{f, a}
+	}
+
+	return f
+}
+
+// Returns the fetcher for the flags, for a source that archives itself.
+func (o *options) unarchivedFetcher() Fetcher {
+	if o.fixtures != "" {
+		return &fileFetcher{o.fixtures}
+	}
+
+	return newHTTPFetcher(o.timeout, o.userAgent)
+}
+
+// Returns the archive for the flags, or nil if responses are not archived.
+// Recorded responses, and those of a dry run, are not archived.
+func (o *options) archiver() *archive {
+	if o.fixtures != "" || o.archive == "" || o.dryRun {
+		return nil
+	}
+
+	return newArchive(o.archive)
+}
+
+func (o *options) connect() (postgres, error) {
+	cfg, err := loadConfig(o.env)
+	if err != nil {
+		return postgres{}, err
+	}
+
+	return databaseConn(cfg)
+}
+
+func syncOrgs(args []string) error {
+	fs, opts := newFlagSet("sync orgs")
+	fs.StringVar(&opts.src, "src", registerURL, "URL of the lobbyist register XML, which may be compressed with gzip, zip or xz")
+	fs.StringVar(&opts.out, "out", "", "path the lobbyist register XML is also written to while it is imported")
+	onError := fs.String("on-error", "abort", "abort the import at an invalid interestRepresentative, or skip and report it")
+	maxVanish := fs.Float64("max-vanish", 5, "percentage of organizations that may disappear from the register before deregistering them is refused")
+	force := fs.Bool("force", false, "import the register even if it did not change since the last import")
+	opts.fetchFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := parseDecodePolicy(*onError)
+	if err != nil {
+		return err
+	}
+
+	if *maxVanish < 0 || *maxVanish > 100 {
+		return fmt.Errorf("max-vanish must be between 0 and 100, got %g", *maxVanish)
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	prev := validators{}
+
+	if !*force {
+		prev, err = lastValidators(conn.db, "orgs", opts.src)
+		if err != nil {
+			return err
+		}
+	}
+
+	src, err := openSource(opts.unarchivedFetcher(), opts.archiver(), opts.src, opts.out, prev)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	run, err := startRun(conn.db, "orgs", opts.src, opts.dryRun)
+	if err != nil {
+		return err
+	}
+
+	run.validators = src.validators
+
+	if src.unchanged(prev) {
+		log.Printf("register is unchanged since the last import, skipping it\n")
+		return run.finishUnchanged(conn.db)
+	}
+
+	err = importRegister(src, conn.db, run, importOptions{policy, *maxVanish, opts.dryRun, false})
+	if err == nil {
+		run.sha256, err = src.Sum()
+	}
+
+	return run.finish(conn.db, err)
+}
+
+func syncDepartments(args []string) error {
+	fs, opts := newFlagSet("sync departments")
+	fs.StringVar(&opts.src, "src", filepath.Join("database", "departments"), "directory with the department JSON files")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	run, err := startRun(conn.db, "departments", opts.src, opts.dryRun)
+	if err != nil {
+		return err
+	}
+
+	return run.finish(conn.db, upsertDepartments(opts.src, conn.db, run, opts.dryRun))
+}
+
+func scrapeMeetings(args []string) error {
+	fs, opts := newFlagSet("scrape meetings")
+	fs.StringVar(&opts.src, "src", meetingsURL, "host that serves the meeting pages")
+	opts.fetchFlags(fs)
+	dir := fs.String("departments", filepath.Join("database", "departments"), "directory with the department JSON files")
+	concurrency := fs.Int("concurrency", 4, "number of host IDs that are scraped at the same time")
+	interval := fs.Duration("interval", 250*time.Millisecond, "minimum time between requests, shared by all workers")
+	maxPages := fs.Int("max-pages", 0, "maximum number of pages per host ID, 0 for no limit")
+	attempts := fs.Int("attempts", 5, "maximum number of attempts per page")
+	gazetteer := fs.String("gazetteer", filepath.Join("database", "gazetteer.json"), "gazetteer that meeting locations are normalized with")
+	incremental := fs.Bool("incremental", false, "stop paging at the first page with meetings that are already stored")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", *concurrency)
+	}
+
+	if *attempts < 1 {
+		return fmt.Errorf("attempts must be at least 1, got %d", *attempts)
+	}
+
+	if *interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", *interval)
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	run, err := startRun(conn.db, "meetings", opts.src, opts.dryRun)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	conn, err := databaseConn(cfg)
+	err = meetings(*dir, opts.fetcher(), scrapeOptions{
+		host:        opts.src,
+		concurrency: *concurrency,
+		interval:    *interval,
+		maxPages:    *maxPages,
+		attempts:    *attempts,
+		incremental: *incremental,
+		gazetteer:   *gazetteer,
+		dryRun:      opts.dryRun,
+	}, run, conn.db)
+
+	return run.finish(conn.db, err)
+}
+
+func reviewMembersCmd(args []string) error {
+	fs, opts := newFlagSet("review members")
+	fs.StringVar(&opts.out, "out", filepath.Join("database", "departments"), "directory with the department JSON files that aliases are added to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return reviewMembers(opts.out, conn.db, os.Stdin, os.Stdout, opts.dryRun)
+}
+
+func matchEntitiesCmd(args []string) error {
+	fs, opts := newFlagSet("match entities")
+	threshold := fs.Float64("threshold", 0.6, "minimum trigram similarity of a suggested organization, between 0 and 1")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *threshold <= 0 || *threshold > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1, got %g", *threshold)
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return matchEntities(conn.db, *threshold, opts.dryRun)
+}
+
+func listRunsCmd(args []string) error {
+	fs, opts := newFlagSet("runs")
+	limit := fs.Int("limit", 20, "number of runs to list")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return listRuns(conn.db, *limit, os.Stdout)
+}
+
+func diffRunsCmd(args []string) error {
+	fs, opts := newFlagSet("runs diff")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: runs diff [flags] <from run ID> <to run ID>\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected two run IDs, got %d", fs.NArg())
+	}
+
+	ids := make([]int64, 2)
+
+	for i, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid run ID %q", arg)
+		}
+
+		ids[i] = id
+	}
+
+	conn, err := opts.connect()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	defer conn.Close()
 
-	// TODO: Convert meeting fields into a unique SHA1 hash
-	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte("test"))
+	return diffRuns(conn.db, ids[0], ids[1], os.Stdout)
+}
 
-	fmt.Println("id:", id)
+func replay(args []string) error {
+	fs, opts := newFlagSet("replay")
+	fs.StringVar(&opts.src, "src", registerURL, "URL of the lobbyist register the snapshot was downloaded from")
+	fs.StringVar(&opts.archive, "archive", filepath.Join("database", "archive"), "directory with the archived snapshots")
+	date := fs.String("date", "", "replay the last snapshot downloaded on or before this date, as YYYY-MM-DD")
+	sum := fs.String("sha256", "", "replay the snapshot with this SHA-256, or a prefix of it, as listed by the runs command")
+	onError := fs.String("on-error", "abort", "abort the import at an invalid interestRepresentative, or skip and report it")
 
-	// if err := conn.Backup(); err != nil {
-	// 	log.Fatal(err)
-	// }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	// if err := upsertDepartments(conn.db); err != nil {
-	// 	log.Fatal(err)
-	// }
+	if (*date == "") == (*sum == "") {
+		return fmt.Errorf("expected either -date or -sha256")
+	}
 
-	// if err := meetings(conn.db); err != nil {
-	// 	log.Fatal(err)
-	// }
+	// Snapshots of the whole day are included.
+	before := time.Now()
 
-	src := "http://ec.europa.eu/transparencyregister/public/consultation/statistics.do?action=getLobbyistsXml&fileType=NEW"
-	dst := "test.xml"
+	if *date != "" {
+		day, err := time.ParseInLocation("2006-01-02", *date, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", *date)
+		}
 
-	if err := downloadFile(src, dst); err != nil {
-		log.Fatal(err)
+		before = day.AddDate(0, 0, 1)
 	}
 
-	if err := processXML(dst, conn.db); err != nil {
-		log.Fatal(err)
+	policy, err := parseDecodePolicy(*onError)
+	if err != nil {
+		return err
 	}
 
+	a := newArchive(opts.archive)
+
+	snaps, err := a.snapshots()
+	if err != nil {
+		return err
+	}
+
+	snap, err := findSnapshot(snaps, opts.src, *sum, before)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("replaying snapshot %s, downloaded at %s\n", snap.File, snap.FetchedAt.Format(time.RFC3339))
+
+	src, err := a.open(snap)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	run, err := startRun(conn.db, "orgs", snap.URL, opts.dryRun)
+	if err != nil {
+		return err
+	}
+
+	// The next sync compares the register to the snapshot, which is now
+	// imported, rather than to what the server last sent.
+	run.sha256 = snap.SHA256
+
+	return run.finish(conn.db, importRegister(src, conn.db, run, importOptions{policy, 0, opts.dryRun, true}))
+}
+
+func pruneArchiveCmd(args []string) error {
+	fs, opts := newFlagSet("archive prune")
+	fs.StringVar(&opts.archive, "archive", filepath.Join("database", "archive"), "directory with the archived snapshots")
+	keepDays := fs.Int("keep-days", 90, "number of days snapshots are kept, the last snapshot of each URL is always kept")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *keepDays < 0 {
+		return fmt.Errorf("keep-days must not be negative, got %d", *keepDays)
+	}
+
+	return newArchive(opts.archive).prune(time.Now().AddDate(0, 0, -*keepDays), opts.dryRun)
+}
+
+func backup(args []string) error {
+	fs, opts := newFlagSet("backup")
+	fs.StringVar(&opts.out, "out", filepath.Join("database", "backups"), "directory the dump is written to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := filepath.Join(opts.out, fmt.Sprintf("DB_%s.dump", time.Now().Format("2006-01-02")))
+
+	if opts.dryRun {
+		log.Printf("dry run, would write backup to: %s\n", path)
+		return nil
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := conn.Backup(path); err != nil {
+		return err
+	}
+
+	log.Printf("finished backup: %s\n", path)
+
+	return nil
+}
+
+func migrate(args []string) error {
+	fs, opts := newFlagSet("migrate")
+	fs.StringVar(&opts.src, "src", filepath.Join("database", "migrations"), "directory with the SQL migrations")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := opts.connect()
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return conn.Migrate(opts.src, opts.dryRun)
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/imjasonmiller/godice"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The minimum score for a fuzzy match, unless a department sets its own.
+const defaultMatchThreshold = 0.75
+
+// Replacements for letters that have no decomposition, so they do not fold to
+// ASCII by removing a combining mark.
+var foldSpecial = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+// Fold a name to lowercase ASCII letters, so "José  Eduardo" and "jose eduardo"
+// are equal. Punctuation other than hyphens and apostrophes separates words.
+func foldName(name string) string {
+	var b strings.Builder
+
+	// Decompose letters into a base letter and combining marks, such as "é"
+	// into "e" and U+0301, so the marks can be dropped.
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '\''):
+			b.WriteRune(r)
+		case foldSpecial[r] != "":
+			b.WriteString(foldSpecial[r])
+		case unicode.Is(unicode.Mn, r):
+			// Drop the combining marks.
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Matches names on meeting pages to the members of a department.
+type memberMatcher struct {
+	threshold float64
+	ids       map[string]string // Member IDs by folded name or alias.
+	names     map[string]string // Member names by folded name or alias.
+	folded    []string
+}
+
+func newMemberMatcher(dep department) *memberMatcher {
+	m := &memberMatcher{
+		threshold: dep.MatchThreshold,
+		ids:       map[string]string{},
+		names:     map[string]string{},
+	}
+
+	if m.threshold <= 0 {
+		m.threshold = defaultMatchThreshold
+	}
+
+	for _, member := range dep.Members {
+		for _, name := range append([]string{member.Name}, member.Aliases...) {
+			key := foldName(name)
+
+			if _, ok := m.ids[key]; ok {
+				continue
+			}
+
+			m.ids[key] = *member.ID
+			m.names[key] = member.Name
+			m.folded = append(m.folded, key)
+		}
+	}
+
+	return m
+}
+
+// Returns the ID of the member with the given name. An exact match on a
+// folded name or alias is tried first, followed by a fuzzy match. If neither
+// succeeds, the best candidate is returned with its score.
+func (m *memberMatcher) match(name string) (string, godice.Match, bool) {
+	key := foldName(name)
+
+	if id, ok := m.ids[key]; ok {
+		return id, godice.Match{Text: m.names[key], Score: 1}, true
+	}
+
+	matches, err := godice.CompareStrings(key, m.folded)
+	if err != nil {
+		return "", godice.Match{}, false
+	}
+
+	best := godice.Match{Text: m.names[matches.BestMatch.Text], Score: matches.BestMatch.Score}
+
+	if best.Score < m.threshold {
+		return "", best, false
+	}
+
+	return m.ids[matches.BestMatch.Text], best, true
+}
+
+// Returns the ID of the member with the given display name.
+func (m *memberMatcher) memberID(name string) string {
+	return m.ids[foldName(name)]
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestFoldName(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"accents":     {"José Eduardo Leandro", "jose eduardo leandro"},
+		"case":        {"LEÓN DELVAUX", "leon delvaux"},
+		"whitespace":  {"  Carlo\n   Zadra ", "carlo zadra"},
+		"initials":    {"J.E. Leandro", "j e leandro"},
+		"hyphen":      {"Paulina Dejmek-Hack", "paulina dejmek-hack"},
+		"special":     {"Łukasz Ørsted-Strauß", "lukasz orsted-strauss"},
+		"decomposed":  {"José", "jose"},
+		"non-latin":   {"Δημήτρης", "δημητρης"},
+		"caron":       {"Jiří Šťastný", "jiri stastny"},
+		"rare marks":  {"Ǎǧȩ Ṣḗ", "age se"},
+		"vietnamese":  {"Nguyễn Thị Ánh", "nguyen thi anh"},
+		"apostrophes": {"Seán O'Brien", "sean o'brien"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if output := foldName(test.input); output != test.expected {
+				t.Errorf("expected %q to be %q, got %q", test.input, test.expected, output)
+			}
+		})
+	}
+}
+
+func TestMemberMatcher(t *testing.T) {
+	ids := []string{
+		"6d54f0cc-1e97-46ed-8409-7710305b1fbd",
+		"e5f5592a-15e8-4e65-960c-3dee8a60e5f4",
+	}
+
+	dep := department{
+		Members: []member{
+			{ID: &ids[0], Name: "José Eduardo Leandro", Aliases: []string{"J. E. Leandro"}},
+			{ID: &ids[1], Name: "Carlo Zadra"},
+		},
+	}
+
+	tests := map[string]struct {
+		threshold float64
+		input     string
+		expected  string
+	}{
+		"exact":            {0, "Carlo Zadra", ids[1]},
+		"without accents":  {0, "Jose Eduardo Leandro", ids[0]},
+		"case":             {0, "JOSÉ EDUARDO LEANDRO", ids[0]},
+		"alias":            {0, "J.E. Leandro", ids[0]},
+		"reordered":        {0, "Leandro, José Eduardo", ids[0]},
+		"typo":             {0, "Carlo Zadrra", ids[1]},
+		"unknown":          {0, "Jane Unknown", ""},
+		"strict threshold": {0.99, "Carlo Zadrra", ""},
+		"loose threshold":  {0.5, "Carla Zedra", ids[1]},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dep.MatchThreshold = test.threshold
+
+			id, best, _ := newMemberMatcher(dep).match(test.input)
+			if id != test.expected {
+				t.Errorf("expected %q to match %q, got %q with a best match of %+v", test.input, test.expected, id, best)
+			}
+		})
+	}
+}
@@ -3,25 +3,77 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"net/http"
-	"path/filepath"
+	"log"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	// Embed the time zone database, as meeting dates are parsed in Europe/Brussels.
+	_ "time/tzdata"
+
 	"github.com/PuerkitoBio/goquery"
-	"github.com/imjasonmiller/godice"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/net/html"
 )
 
 type meeting struct {
 	id       string
 	members  []string
-	date     string
+	date     time.Time
 	canceled bool
 	location string
-	entities []string
+	entities []entity
 	subjects string
+	topics   []string
+	place    place
+}
+
+// Namespace for meeting IDs, derived from the project URL in the URL namespace.
+var meetingNamespace = uuid.Must(uuid.Parse("675e69f0-cfdf-5071-9161-77873d53a549"))
+
+// Collapse runs of whitespace and fold case, so cosmetic changes on a page
+// do not result in a different meeting.
+func canonicalText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// Returns a content-addressed ID for a meeting hosted by the given leader.
+// A meeting that is listed on both the leader and member page of a leader
+// results in the same ID. Whether it was canceled is left out, as it may
+// change after the meeting was first listed.
+func meetingID(leaderID string, m meeting) string {
+	// Entities without a register number are hashed by their name. Migration
+	// 012_unregistered_meeting_ids computes the same in SQL.
+	entities := make([]string, len(m.entities))
+	for i, e := range m.entities {
+		entities[i] = e.id
+		if e.id == "" {
+			entities[i] = "u:" + canonicalText(e.name)
+		}
+	}
+
+	sort.Strings(entities)
+
+	// Remove duplicate entities.
+	unique := entities[:0]
+	for i, e := range entities {
+		if i == 0 || e != entities[i-1] {
+			unique = append(unique, e)
+		}
+	}
+
+	fields := []string{
+		"host=" + strings.ToLower(leaderID),
+		"date=" + m.date.Format("2006-01-02"),
+		"location=" + canonicalText(m.location),
+		"subjects=" + canonicalText(m.subjects),
+		"entities=" + strings.Join(unique, ","),
+	}
+
+	return uuid.NewSHA1(meetingNamespace, []byte(strings.Join(fields, "\n"))).String()
 }
 
 // Given a node, traverse all children, then apply the passed function to each.
@@ -37,9 +89,41 @@ func traverseNodes(node *html.Node, fn func(*html.Node)) {
 	}
 }
 
-func meetingDate(sel *goquery.Selection) string {
+// Meeting dates are local to Brussels.
+var brussels = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Brussels")
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}()
+
+// An error in a table row of a meeting page. Rows are numbered from 1.
+type rowError struct {
+	page string
+	row  int
+	err  error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("%s, row %d: %v", e.page, e.row, e.err)
+}
+
+func meetingDate(sel *goquery.Selection) (time.Time, error) {
 	exp := regexp.MustCompile(`(?:\d{2}\/\d{2}\/\d{4})`)
-	return exp.FindString(sel.Text())
+
+	text := exp.FindString(sel.Text())
+	if text == "" {
+		return time.Time{}, fmt.Errorf("missing date in %q", strings.TrimSpace(sel.Text()))
+	}
+
+	// Parsing fails on dates that do not exist, such as 31/02.
+	date, err := time.ParseInLocation("02/01/2006", text, brussels)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", text)
+	}
+
+	return date, nil
 }
 
 func meetingCanceled(sel *goquery.Selection) bool {
@@ -51,83 +135,146 @@ func meetingLocation(sel *goquery.Selection) string {
 	return strings.TrimSpace(sel.Text())
 }
 
-func meetingMembers(dep *[]member, sel *goquery.Selection) []string {
+// Returns the IDs of the members in sel. Names that can not be matched to a
+// member are appended to unresolved, along with the best candidate.
+func meetingMembers(matcher *memberMatcher, sel *goquery.Selection, unresolved *[]unresolvedMember) []string {
 	result := []string{}
 
-	memberNames := []string{}
-	memberNameToID := map[string]string{}
-
-	for _, member := range *dep {
-		memberNames = append(memberNames, member.Name)
-		memberNameToID[member.Name] = *member.ID
-	}
-
-	sel.Contents().EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+	// Names are separated by line breaks, which are skipped along with empty
+	// text and unknown names.
+	sel.Contents().Each(func(_ int, sel *goquery.Selection) {
 		if sel.Is("br") {
-			return false
+			return
 		}
 
 		name := strings.TrimSpace(sel.Text())
 
 		if len(name) < 1 {
-			return false
+			return
 		}
 
 		// Check if member exists.
-		matches, err := godice.CompareStrings(name, memberNames)
-		if err != nil {
-			fmt.Println(name, err)
+		id, best, ok := matcher.match(name)
+		if !ok {
+			*unresolved = append(*unresolved, unresolvedMember{
+				text:        name,
+				candidate:   best.Text,
+				candidateID: matcher.memberID(best.Text),
+				score:       best.Score,
+			})
+			return
 		}
 
-		// fmt.Println("input", name, "best match:", matches.BestMatch.Text)
+		result = append(result, id)
+	})
 
-		if matches.BestMatch.Score < 0.75 {
-			fmt.Printf("could not find \"%s\"; Best match was: \"%s\", with a score of: %.f\n", name, matches.BestMatch.Text, matches.BestMatch.Score)
-			return false
+	return result
+}
+
+// An organization in a meeting. The ID is its number in the transparency
+// register, which is empty for organizations that are not registered.
+type entity struct {
+	id   string
+	name string
+}
+
+// Returns the text of a node and its children.
+func nodeText(node *html.Node) string {
+	var text string
+
+	traverseNodes(node, func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text += node.Data
 		}
+	})
+
+	return text
+}
 
-		if id, ok := memberNameToID[matches.BestMatch.Text]; ok {
-			result = append(result, id)
+// Returns the name of the entity that a comment node belongs to. This is the
+// text in front of the comment, up to the previous comment or line break, or
+// otherwise the text of its parent.
+func entityName(comment *html.Node) string {
+	var name string
+
+	for cur := comment.PrevSibling; cur != nil; cur = cur.PrevSibling {
+		if cur.Type == html.CommentNode || (cur.Type == html.ElementNode && cur.Data == "br") {
+			break
 		}
 
-		return true
-	})
+		name = nodeText(cur) + name
+	}
 
-	return result
+	if strings.TrimSpace(name) == "" && comment.Parent != nil && comment.Parent.Data != "td" {
+		name = nodeText(comment.Parent)
+	}
+
+	return strings.Join(strings.Fields(name), " ")
 }
 
-func meetingEntities(sel *goquery.Selection) []string {
-	entities := []string{}
+func meetingEntities(sel *goquery.Selection) []entity {
+	entities := []entity{}
 
 	// Get entities from comment nodes in selection.
 	traverseNodes(sel.Nodes[0], func(node *html.Node) {
 		if node.Type == html.CommentNode {
 			exp := regexp.MustCompile(`id=([0-9]+-[0-9]+)`)
 
+			e := entity{name: entityName(node)}
+
 			if id := exp.FindStringSubmatch(node.Data); id != nil {
-				entities = append(entities, id[1])
-			} else {
-				entities = append(entities, "Unregistered")
+				e.id = id[1]
 			}
+
+			entities = append(entities, e)
 		}
 	})
 
 	return entities
 }
 
+// Returns the subjects in sel, a line for each. Subjects are separated by line
+// breaks, which Text drops without a separator.
 func meetingSubjects(sel *goquery.Selection) string {
-	return strings.TrimSpace(sel.Text())
+	lines := []string{}
+
+	var line string
+
+	traverseNodes(sel.Nodes[0], func(node *html.Node) {
+		switch {
+		case node.Type == html.TextNode:
+			line += node.Data
+		case node.Type == html.ElementNode && node.Data == "br":
+			lines = append(lines, line)
+			line = ""
+		}
+	})
+
+	lines = append(lines, line)
+
+	// Skip empty lines, such as those of consecutive line breaks.
+	subjects := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+
+	return strings.Join(subjects, "\n")
 }
 
-// Functions byLeader and byMember reference "meetings" via a closure
-func byLeader(meetings *[]meeting) func(int, *goquery.Selection) {
-	return func(_ int, sel *goquery.Selection) {
+// Functions byLeader and byMember reference "meetings" via a closure. Rows
+// that can not be parsed are left out and appended to errs instead.
+func byLeader(meetings *[]meeting, errs *[]*rowError) func(int, *goquery.Selection) {
+	return func(row int, sel *goquery.Selection) {
 		meeting := meeting{}
 
+		var err error
+
 		sel.Find("td").Each(func(i int, sel *goquery.Selection) {
 			switch i {
 			case 0:
-				meeting.date = meetingDate(sel)
+				meeting.date, err = meetingDate(sel)
 				meeting.canceled = meetingCanceled(sel)
 			case 1:
 				meeting.location = meetingLocation(sel)
@@ -135,23 +282,31 @@ func byLeader(meetings *[]meeting) func(int, *goquery.Selection) {
 				meeting.entities = meetingEntities(sel)
 			case 3:
 				meeting.subjects = meetingSubjects(sel)
+				meeting.topics = meetingTopics(meeting.subjects)
 			}
 		})
 
+		if err != nil {
+			*errs = append(*errs, &rowError{row: row + 1, err: err})
+			return
+		}
+
 		*meetings = append(*meetings, meeting)
 	}
 }
 
-func byMember(members *[]member, meetings *[]meeting) func(int, *goquery.Selection) {
-	return func(_ int, sel *goquery.Selection) {
+func byMember(matcher *memberMatcher, meetings *[]meeting, unresolved *[]unresolvedMember, errs *[]*rowError) func(int, *goquery.Selection) {
+	return func(row int, sel *goquery.Selection) {
 		meeting := meeting{}
 
+		var err error
+
 		sel.Find("td").Each(func(i int, sel *goquery.Selection) {
 			switch i {
 			case 0:
-				meeting.members = meetingMembers(members, sel)
+				meeting.members = meetingMembers(matcher, sel, unresolved)
 			case 1:
-				meeting.date = meetingDate(sel)
+				meeting.date, err = meetingDate(sel)
 				meeting.canceled = meetingCanceled(sel)
 			case 2:
 				meeting.location = meetingLocation(sel)
@@ -159,89 +314,605 @@ func byMember(members *[]member, meetings *[]meeting) func(int, *goquery.Selecti
 				meeting.entities = meetingEntities(sel)
 			case 4:
 				meeting.subjects = meetingSubjects(sel)
+				meeting.topics = meetingTopics(meeting.subjects)
 			}
 		})
 
-		// fmt.Printf("%+v", meeting.members)
+		if err != nil {
+			*errs = append(*errs, &rowError{row: row + 1, err: err})
+			return
+		}
 
 		*meetings = append(*meetings, meeting)
 	}
 }
 
-func scrape(extract func(int, *goquery.Selection), host, path string) error {
-	// Request document.
-	res, err := http.Get(fmt.Sprint(host, path))
+// A listing of meetings to scrape, for either a leader or their members.
+type scrapeJob struct {
+	leader   leader
+	members  *memberMatcher
+	hostID   string
+	byLeader bool
+}
+
+type scrapeResult struct {
+	job   scrapeJob
+	count int
+	err   error
+}
+
+// Scrape the meetings of every leader in dir, and those of their members.
+// Host IDs are scraped concurrently and share a single rate limiter. Each
+// page is upserted once scraped, so a failing host keeps its progress.
+func meetings(dir string, f Fetcher, opts scrapeOptions, run *importRun, db *sql.DB) error {
+	jobs := []scrapeJob{}
+
+	err := forEachDepartment(dir, func(dep department) error {
+		members := newMemberMatcher(dep)
+
+		for _, l := range dep.Leaders {
+			if l.LeaderHostID != "" {
+				jobs = append(jobs, scrapeJob{l, members, l.LeaderHostID, true})
+			}
+
+			if l.MemberHostID != "" && len(dep.Members) > 0 {
+				jobs = append(jobs, scrapeJob{l, members, l.MemberHostID, false})
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		if res.StatusCode == http.StatusTooManyRequests {
-			return fmt.Errorf("requests are rate limited")
-		}
+	countries, err := countryNameToCode(db)
+	if err != nil {
+		return err
+	}
 
-		return fmt.Errorf("bad response from server: %s", res.Status)
+	g, err := loadGazetteer(opts.gazetteer, countries)
+	if err != nil {
+		return err
 	}
 
-	defer res.Body.Close()
+	s := newScraper(f, opts)
+	defer s.Stop()
 
-	// Parse response with goquery.
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to parse %s: %v", path, err)
+	return scrapeHosts(s, g, jobs, opts, run, crawlDB{db})
+}
+
+// Scrape the jobs with opts.concurrency workers, which share the rate limiter
+// of s. A host that fails does not stop the others.
+func scrapeHosts(s *scraper, g *gazetteer, jobs []scrapeJob, opts scrapeOptions, run *importRun, store crawlStore) error {
+	queue := make(chan scrapeJob)
+	results := make(chan scrapeResult)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range queue {
+				count, err := crawlHost(s, g, job, opts, run, store)
+				results <- scrapeResult{job, count, err}
+			}
+		}()
 	}
 
-	// Iterate over table rows and extract data.
-	doc.Find("#listMeetingsTable tbody tr").Each(extract)
+	go func() {
+		for _, job := range jobs {
+			queue <- job
+		}
+		close(queue)
+
+		wg.Wait()
+		close(results)
+	}()
 
-	// Timeout to prevent rate limits.
-	time.Sleep(250 * time.Millisecond)
+	failed := 0
 
-	// Find next page href and recur.
-	if next, ok := doc.Find(".pagelinks a img[alt='Next']").Parent().Attr("href"); ok {
-		return scrape(extract, host, next)
+	for res := range results {
+		if res.err != nil {
+			failed++
+			log.Printf("could not scrape host %s of %s: %v\n", res.job.hostID, res.job.leader.Name, res.err)
+			run.fail(fmt.Errorf("host %s: %v", res.job.hostID, res.err))
+		}
+
+		log.Printf("scraped %d meetings from host %s of %s\n", res.count, res.job.hostID, res.job.leader.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(jobs))
 	}
 
 	return nil
 }
 
-func meetings(db *sql.DB) error {
-	err := forEachDepartment(filepath.Join("database", "departments"), func(dep department) error {
-		for _, l := range dep.Leaders {
-			leaderMeetings := &[]meeting{}
-			memberMeetings := &[]meeting{}
+// Scrape the listing of a single host ID, resuming from its checkpoint if the
+// previous crawl did not complete. Returns the number of meetings scraped.
+func crawlHost(s *scraper, g *gazetteer, job scrapeJob, opts scrapeOptions, run *importRun, store crawlStore) (int, error) {
+	cp, err := store.loadCheckpoint(job.hostID)
+	if err != nil {
+		return 0, err
+	}
 
-			host := "http://ec.europa.eu"
+	path := fmt.Sprint("/transparencyinitiative/meetings/meeting.do?host=", job.hostID)
 
-			if l.LeaderHostID != "" {
-				path := fmt.Sprint("/transparencyinitiative/meetings/meeting.do?host=", l.LeaderHostID)
-				if err := scrape(byLeader(leaderMeetings), host, path); err != nil {
-					return err
-				}
+	if cp.resumable() {
+		log.Printf("resuming host %s at page %d\n", job.hostID, cp.pages+1)
+		path = cp.nextPage
+	} else {
+		cp = checkpoint{hostID: job.hostID}
+	}
+
+	found := &[]meeting{}
+	unresolved := &[]unresolvedMember{}
+	errs := &[]*rowError{}
+	extract := byLeader(found, errs)
+
+	if !job.byLeader {
+		extract = byMember(job.members, found, unresolved, errs)
+	}
+
+	count := 0
+
+	err = s.scrape(extract, path, func(path, next string) (bool, error) {
+		for _, e := range *errs {
+			e.page = fmt.Sprint(s.host, path)
+			log.Printf("skipping meeting: %v\n", e)
+			run.fail(e)
+		}
+
+		run.count(0, int64(len(*errs)))
+
+		*errs = (*errs)[:0]
+
+		for i := range *found {
+			(*found)[i].id = meetingID(*job.leader.ID, (*found)[i])
+			(*found)[i].place = g.locate((*found)[i].location)
+		}
+
+		count += len(*found)
+
+		// Listings are ordered by date, so older pages are already stored.
+		more := true
+
+		if opts.incremental {
+			stored, err := store.storedMeetings(job, *found)
+			if err != nil {
+				return false, err
 			}
 
-			if l.MemberHostID != "" && len(dep.Members) > 0 {
-				path := fmt.Sprint("/transparencyinitiative/meetings/meeting.do?host=", l.MemberHostID)
-				if err := scrape(byMember(&dep.Members, memberMeetings), host, path); err != nil {
-					return err
-				}
+			more = stored == 0
+		}
+
+		cp.pages++
+		cp.lastPage = path
+		cp.nextPage = next
+
+		if !more || next == "" {
+			cp.completedAt = pq.NullTime{Time: time.Now(), Valid: true}
+		}
+
+		for i := range *unresolved {
+			(*unresolved)[i].hostID = job.hostID
+			(*unresolved)[i].page = fmt.Sprint(s.host, path)
+		}
+
+		if opts.dryRun {
+			for _, u := range *unresolved {
+				log.Printf("dry run, could not resolve member %q on %s\n", u.text, u.page)
 			}
 
-			err := bulkUpsertMeetings(leaderMeetings, memberMeetings)
-			if err != nil {
-				break
+			*found = (*found)[:0]
+			*unresolved = (*unresolved)[:0]
+			return more, nil
+		}
+
+		if err := store.savePage(job, *found, *unresolved, cp, run); err != nil {
+			return false, err
+		}
+
+		*found = (*found)[:0]
+		*unresolved = (*unresolved)[:0]
+
+		return more, nil
+	})
+
+	return count, err
+}
+
+// Returns how many of the given meetings are already linked to the host.
+func storedMeetings(job scrapeJob, meetings []meeting, db *sql.DB) (int, error) {
+	ids := make([]string, len(meetings))
+	for i, m := range meetings {
+		ids[i] = m.id
+	}
+
+	table := "leaders_meetings"
+	if !job.byLeader {
+		table = "members_meetings"
+	}
+
+	var count int
+
+	err := db.QueryRow(
+		fmt.Sprintf(`SELECT count(*) FROM %s WHERE leader_id = $1 AND meeting_id = ANY($2::UUID[])`, table),
+		*job.leader.ID, pq.Array(ids),
+	).Scan(&count)
+
+	return count, err
+}
+
+// Copy rows into a temporary table with the given columns.
+func copyRows(txn *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	stmt, err := txn.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// Upsert the meetings of a leader and those of their members. Meetings are
+// matched on their ID, so re-runs do not result in duplicates.
+func bulkUpsertMeetings(leaderID string, leaderMeetings, memberMeetings *[]meeting, run *importRun, db *sql.DB) error {
+	meetingRows := [][]interface{}{}
+	leaderRows := [][]interface{}{}
+	memberRows := [][]interface{}{}
+	entityRows := [][]interface{}{}
+	unregisteredRows := [][]interface{}{}
+	topicRows := [][]interface{}{}
+
+	add := func(m meeting, byLeader bool) {
+		// Locations that could not be found are stored as NULL.
+		var city, country, latitude, longitude interface{}
+
+		if m.place.city != nil {
+			city, latitude, longitude = m.place.city.Name, m.place.city.Latitude, m.place.city.Longitude
+		}
+
+		if m.place.country != "" {
+			country = m.place.country
+		}
+
+		meetingRows = append(meetingRows, []interface{}{
+			m.id, m.date.Format("2006-01-02"), m.canceled, m.location, m.subjects,
+			city, country, latitude, longitude,
+		})
+
+		if byLeader {
+			leaderRows = append(leaderRows, []interface{}{m.id})
+		}
+
+		for _, id := range m.members {
+			memberRows = append(memberRows, []interface{}{m.id, id})
+		}
+
+		for _, e := range m.entities {
+			switch {
+			case e.id != "":
+				entityRows = append(entityRows, []interface{}{m.id, e.id, e.name})
+			case e.name != "":
+				unregisteredRows = append(unregisteredRows, []interface{}{m.id, e.name})
 			}
 		}
+
+		for _, topic := range m.topics {
+			topicRows = append(topicRows, []interface{}{m.id, topic})
+		}
+	}
+
+	for _, m := range *leaderMeetings {
+		add(m, true)
+	}
+
+	for _, m := range *memberMeetings {
+		add(m, false)
+	}
+
+	if len(meetingRows) == 0 {
 		return nil
-	})
+	}
+
+	// Start transaction.
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	// Create temporary tables that are dropped on commit.
+	_, err = txn.Exec(`
+		CREATE TEMP TABLE meetings_temp (
+			meeting_id          UUID    NOT NULL,
+			meeting_date        DATE    NOT NULL,
+			meeting_canceled    BOOLEAN NOT NULL,
+			meeting_location    TEXT    NOT NULL,
+			meeting_subjects    TEXT    NOT NULL,
+			meeting_city        TEXT,
+			meeting_country     TEXT,
+			meeting_latitude    DOUBLE PRECISION,
+			meeting_longitude   DOUBLE PRECISION
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE leaders_meetings_temp (
+			meeting_id          UUID    NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE members_meetings_temp (
+			meeting_id          UUID    NOT NULL,
+			member_id           UUID    NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE organizations_meetings_temp (
+			meeting_id          UUID    NOT NULL,
+			organization_id     TEXT    NOT NULL,
+			entity_name         TEXT    NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE unregistered_entities_meetings_temp (
+			meeting_id          UUID    NOT NULL,
+			entity_name         TEXT    NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE meeting_topics_temp (
+			meeting_id          UUID    NOT NULL,
+			topic_name          TEXT    NOT NULL
+		) ON COMMIT DROP;
+	`)
+	if err != nil {
+		return err
+	}
+
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"meetings_temp", []string{
+			"meeting_id", "meeting_date", "meeting_canceled", "meeting_location", "meeting_subjects",
+			"meeting_city", "meeting_country", "meeting_latitude", "meeting_longitude",
+		}, meetingRows},
+		{"leaders_meetings_temp", []string{"meeting_id"}, leaderRows},
+		{"members_meetings_temp", []string{"meeting_id", "member_id"}, memberRows},
+		{"organizations_meetings_temp", []string{"meeting_id", "organization_id", "entity_name"}, entityRows},
+		{"unregistered_entities_meetings_temp", []string{"meeting_id", "entity_name"}, unregisteredRows},
+		{"meeting_topics_temp", []string{"meeting_id", "topic_name"}, topicRows},
+	}
+
+	for _, c := range copies {
+		if err := copyRows(txn, c.table, c.columns, c.rows); err != nil {
+			return fmt.Errorf("could not copy into %s: %v", c.table, err)
+		}
+	}
+
+	// Insert from temp to real table. A meeting seen on both the leader and
+	// member page is inserted once, preferring the canceled listing.
+	rows, err := txn.Query(`
+		INSERT INTO meetings (
+			meeting_id, meeting_date, meeting_canceled, meeting_location, meeting_subjects,
+			meeting_city, meeting_country, meeting_latitude, meeting_longitude
+		)
+		SELECT DISTINCT ON (meeting_id)
+			meeting_id, meeting_date, meeting_canceled, meeting_location, meeting_subjects,
+			meeting_city, countries.country_id, meeting_latitude, meeting_longitude
+		FROM meetings_temp
+		LEFT JOIN countries ON countries.country_code = meetings_temp.meeting_country
+		ORDER BY meeting_id, meeting_canceled DESC
+		ON CONFLICT (meeting_id)
+		DO UPDATE SET
+			meeting_canceled = EXCLUDED.meeting_canceled,
+			meeting_location = EXCLUDED.meeting_location,
+			meeting_subjects = EXCLUDED.meeting_subjects,
+			meeting_city = EXCLUDED.meeting_city,
+			meeting_country = EXCLUDED.meeting_country,
+			meeting_latitude = EXCLUDED.meeting_latitude,
+			meeting_longitude = EXCLUDED.meeting_longitude
+		WHERE (
+			meetings.meeting_canceled, meetings.meeting_location, meetings.meeting_subjects, meetings.meeting_city,
+			meetings.meeting_country, meetings.meeting_latitude, meetings.meeting_longitude
+		) IS DISTINCT FROM (
+			EXCLUDED.meeting_canceled, EXCLUDED.meeting_location, EXCLUDED.meeting_subjects, EXCLUDED.meeting_city,
+			EXCLUDED.meeting_country, EXCLUDED.meeting_latitude, EXCLUDED.meeting_longitude
+		)
+		RETURNING meeting_id, xmax = 0
+	`)
 	if err != nil {
 		return err
 	}
 
+	changes, err := scanChanges(rows)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Exec(`
+		INSERT INTO leaders_meetings (leader_id, meeting_id)
+		SELECT DISTINCT $1::UUID, meeting_id
+		FROM leaders_meetings_temp
+		ON CONFLICT DO NOTHING
+	`, leaderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Exec(`
+		INSERT INTO members_meetings (leader_id, member_id, meeting_id)
+		SELECT DISTINCT $1::UUID, member_id, meeting_id
+		FROM members_meetings_temp
+		ON CONFLICT DO NOTHING
+	`, leaderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Exec(`
+		INSERT INTO organizations_meetings (organization_id, meeting_id, entity_name)
+		SELECT DISTINCT ON (organizations_meetings_temp.organization_id, organizations_meetings_temp.meeting_id)
+			organizations_meetings_temp.organization_id, organizations_meetings_temp.meeting_id, NULLIF(organizations_meetings_temp.entity_name, '')
+		FROM organizations_meetings_temp
+		INNER JOIN organizations USING (organization_id)
+		ON CONFLICT (organization_id, meeting_id) DO UPDATE SET
+			entity_name = EXCLUDED.entity_name
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Entities that are not (yet) in the register wait for it, see
+	// linkPendingMeetings.
+	result, err := txn.Exec(`
+		INSERT INTO pending_organizations_meetings (organization_id, meeting_id, entity_name)
+		SELECT DISTINCT ON (organizations_meetings_temp.organization_id, organizations_meetings_temp.meeting_id)
+			organizations_meetings_temp.organization_id, organizations_meetings_temp.meeting_id, NULLIF(organizations_meetings_temp.entity_name, '')
+		FROM organizations_meetings_temp
+		WHERE NOT EXISTS (
+			SELECT 1 FROM organizations
+			WHERE organizations.organization_id = organizations_meetings_temp.organization_id
+		)
+		ON CONFLICT (organization_id, meeting_id) DO UPDATE SET
+			entity_name = EXCLUDED.entity_name
+	`)
+	if err != nil {
+		return err
+	}
+
+	pending, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Entities without a register number are stored by their name.
+	_, err = txn.Exec(`
+		INSERT INTO unregistered_entities (entity_name)
+		SELECT DISTINCT entity_name
+		FROM unregistered_entities_meetings_temp
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO unregistered_entities_meetings (entity_id, meeting_id)
+		SELECT DISTINCT unregistered_entities.entity_id, unregistered_entities_meetings_temp.meeting_id
+		FROM unregistered_entities_meetings_temp
+		INNER JOIN unregistered_entities USING (entity_name)
+		ON CONFLICT DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Replace the topics, so they follow changes to meetingTopics.
+	_, err = txn.Exec(`
+		DELETE FROM meeting_topics
+		WHERE meeting_id IN (SELECT meeting_id FROM meetings_temp);
+
+		INSERT INTO meeting_topics (meeting_id, topic_name)
+		SELECT DISTINCT meeting_id, topic_name
+		FROM meeting_topics_temp
+		ON CONFLICT DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return err
+	}
+
+	success = true
+
+	// Meetings are listed on both leader and member pages.
+	unique := map[interface{}]bool{}
+	for _, row := range meetingRows {
+		unique[row[0]] = true
+	}
+
+	for _, c := range changes {
+		run.change(c.kind, c.key)
+	}
+
+	// Entities that are not linked to their organization yet are counted as
+	// skipped, until the register has them.
+	if pending != 0 {
+		log.Printf("%d entities of host %s are not in the register yet\n", pending, leaderID)
+	}
+
+	run.count(int64(len(unique)-len(changes)), pending)
+
 	return nil
 }
 
-func bulkUpsertMeetings(leaderMeetings, memberMeetings *[]meeting) error {
-	fmt.Printf("leaderMeetings: %+v\nmemberMeetings: %+v", *leaderMeetings, *memberMeetings)
-	return nil
+// Link the entities of meetings that are waiting for the register to their
+// organization, once it was imported. Returns how many were linked.
+func linkPendingMeetings(db *sql.DB) (int64, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	result, err := txn.Exec(`
+		INSERT INTO organizations_meetings (organization_id, meeting_id, entity_name)
+		SELECT organization_id, meeting_id, pending_organizations_meetings.entity_name
+		FROM pending_organizations_meetings
+		INNER JOIN organizations USING (organization_id)
+		ON CONFLICT (organization_id, meeting_id) DO UPDATE SET
+			entity_name = EXCLUDED.entity_name
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	linked, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = txn.Exec(`
+		DELETE FROM pending_organizations_meetings
+		WHERE organization_id IN (SELECT organization_id FROM organizations)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	success = true
+
+	return linked, nil
 }
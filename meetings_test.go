@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+)
+
+func TestMeetingID(t *testing.T) {
+	leader := "7d3e3a53-a0e2-4666-9188-9c6d8df156f3"
+	date := time.Date(2018, 9, 21, 0, 0, 0, 0, brussels)
+
+	m := meeting{
+		date:     date,
+		location: "Brussels",
+		entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}},
+		subjects: "Digital Single Market",
+	}
+
+	id := meetingID(leader, m)
+
+	tests := map[string]struct {
+		leader   string
+		meeting  meeting
+		expected bool
+	}{
+		"same meeting": {leader, m, true},
+		"member page": {leader, meeting{
+			members:  []string{"7104a388-f348-4d3b-915a-7c1dcb5f1405"},
+			date:     date,
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}},
+			subjects: "Digital Single Market",
+		}, true},
+		"reordered entities": {leader, meeting{
+			date:     date,
+			location: "Brussels",
+			entities: []entity{{id: "9876543210-98"}, {id: "0123456789-01"}},
+			subjects: "Digital Single Market",
+		}, true},
+		"whitespace and case": {leader, meeting{
+			date:     date,
+			location: "brussels ",
+			entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}},
+			subjects: "Digital  Single\n Market",
+		}, true},
+		"canceled": {leader, meeting{
+			date:     date,
+			canceled: true,
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}},
+			subjects: "Digital Single Market",
+		}, true},
+		"entity names": {leader, meeting{
+			date:     date,
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01", name: "Acme"}, {id: "9876543210-98", name: "Acme Europe"}},
+			subjects: "Digital Single Market",
+		}, true},
+		"unregistered entity": {leader, meeting{
+			date:     date,
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}, {name: "Acme Consulting"}},
+			subjects: "Digital Single Market",
+		}, false},
+		"other leader": {"97b6c61b-219d-4b5e-ae8c-cbe362c8a6e2", m, false},
+		"other date": {leader, meeting{
+			date:     date.AddDate(0, 0, 1),
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01"}, {id: "9876543210-98"}},
+			subjects: "Digital Single Market",
+		}, false},
+		"other entities": {leader, meeting{
+			date:     date,
+			location: "Brussels",
+			entities: []entity{{id: "0123456789-01"}},
+			subjects: "Digital Single Market",
+		}, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if output := meetingID(test.leader, test.meeting); (output == id) != test.expected {
+				t.Errorf("expected equal IDs to be %t, got %s and %s", test.expected, id, output)
+			}
+		})
+	}
+}
+
+func TestMeetingIDUnregistered(t *testing.T) {
+	leader := "7d3e3a53-a0e2-4666-9188-9c6d8df156f3"
+
+	m := func(names ...string) meeting {
+		entities := []entity{{id: "0123456789-01"}}
+		for _, name := range names {
+			entities = append(entities, entity{name: name})
+		}
+
+		return meeting{
+			date:     time.Date(2018, 9, 12, 0, 0, 0, 0, brussels),
+			location: "Brussels",
+			entities: entities,
+			subjects: "Copyright reform",
+		}
+	}
+
+	id := meetingID(leader, m("Acme Consulting"))
+
+	// The name that database/migrations/012_unregistered_meeting_ids.sql
+	// hashes for this meeting, with the entities sorted by byte.
+	name := "host=" + leader + "\ndate=2018-09-12\nlocation=brussels\nsubjects=copyright reform\nentities=0123456789-01,u:acme consulting"
+
+	if expected := uuid.NewSHA1(meetingNamespace, []byte(name)).String(); id != expected {
+		t.Errorf("expected ID to be %s, got %s", expected, id)
+	}
+
+	tests := map[string]struct {
+		meeting  meeting
+		expected bool
+	}{
+		"same name":         {m("Acme Consulting"), true},
+		"whitespace":        {m("  acme\n consulting "), true},
+		"twice":             {m("Acme Consulting", "Acme Consulting"), true},
+		"other name":        {m("Example Partners"), false},
+		"another entity":    {m("Acme Consulting", "Example Partners"), false},
+		"without an entity": {m(), false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if output := meetingID(leader, test.meeting); (output == id) != test.expected {
+				t.Errorf("expected equal IDs to be %t, got %s and %s", test.expected, id, output)
+			}
+		})
+	}
+}
+
+var (
+	update = flag.Bool("update", false, "update the golden files in fixtures/meetings/golden")
+	record = flag.Bool("record", false, "record the pages in fixtures/meetings from the Commission's website")
+)
+
+// An exported copy of meeting, so it can be stored as JSON.
+type goldenMeeting struct {
+	Members  []string       `json:"members"`
+	Date     string         `json:"date"`
+	Canceled bool           `json:"canceled"`
+	Location string         `json:"location"`
+	Entities []goldenEntity `json:"entities"`
+	Subjects string         `json:"subjects"`
+	Topics   []string       `json:"topics"`
+}
+
+type goldenEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type goldenUnresolved struct {
+	Text      string  `json:"text"`
+	Candidate string  `json:"candidate"`
+	Score     float64 `json:"score"`
+}
+
+type goldenPage struct {
+	Next       string             `json:"next"`
+	Meetings   []goldenMeeting    `json:"meetings"`
+	Unresolved []goldenUnresolved `json:"unresolved"`
+	Errors     []string           `json:"errors"`
+}
+
+func newGoldenPage(next string, meetings []meeting, unresolved []unresolvedMember, errs []*rowError) goldenPage {
+	page := goldenPage{Next: next, Meetings: []goldenMeeting{}, Unresolved: []goldenUnresolved{}, Errors: []string{}}
+
+	for _, e := range errs {
+		page.Errors = append(page.Errors, e.Error())
+	}
+
+	for _, u := range unresolved {
+		page.Unresolved = append(page.Unresolved, goldenUnresolved{u.text, u.candidate, u.score})
+	}
+
+	for _, m := range meetings {
+		entities := []goldenEntity{}
+		for _, e := range m.entities {
+			entities = append(entities, goldenEntity{e.id, e.name})
+		}
+
+		page.Meetings = append(page.Meetings, goldenMeeting{
+			Members:  m.members,
+			Date:     m.date.Format(time.RFC3339),
+			Canceled: m.canceled,
+			Location: m.location,
+			Entities: entities,
+			Subjects: m.subjects,
+			Topics:   m.topics,
+		})
+	}
+
+	return page
+}
+
+func TestMeetingSubjects(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"single":        {"Digital Single Market", "Digital Single Market"},
+		"line break":    {"Capital Markets Union<br>Brexit", "Capital Markets Union\nBrexit"},
+		"whitespace":    {"Capital Markets Union<br>\n  Brexit ", "Capital Markets Union\nBrexit"},
+		"nested":        {"<p>Trade<br/>5G</p>", "Trade\n5G"},
+		"empty lines":   {"<br>Trade<br><br>", "Trade"},
+		"without lines": {"", ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<table><tr><td>" + test.input + "</td></tr></table>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output := meetingSubjects(doc.Find("td")); output != test.expected {
+				t.Errorf("expected %q to be %q, got %q", test.input, test.expected, output)
+			}
+		})
+	}
+}
+
+// Compare the meetings on each page in fixtures/meetings to its golden file.
+// Run "go test -update" to rewrite the golden files after a parser change, and
+// "go test -run TestMeetingPages -record -update" to record the pages again
+// from the Commission's website, which shows whether its markup changed.
+func TestMeetingPages(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("database", "departments", "COMM.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dep department
+	if err := json.Unmarshal(data, &dep); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newScraper(&fileFetcher{filepath.Join("fixtures", "meetings")}, scrapeOptions{
+		host:     meetingsURL,
+		interval: time.Millisecond,
+		attempts: 1,
+	})
+
+	defer s.Stop()
+
+	tests := map[string]struct {
+		path     string
+		byLeader bool
+	}{
+		"leader first page": {
+			"/transparencyinitiative/meetings/meeting.do?host=829436d0-1850-424f-aebe-6dd76c793be2",
+			true,
+		},
+		"leader final page": {
+			"/transparencyinitiative/meetings/meeting.do?host=829436d0-1850-424f-aebe-6dd76c793be2&d-6679426-p=2",
+			true,
+		},
+		"member page": {
+			"/transparencyinitiative/meetings/meeting.do?host=91b45ce8-2ff0-4e67-b5b5-b42151217f13",
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if *record {
+				recordPage(t, meetingsURL+test.path)
+			}
+
+			found := &[]meeting{}
+			unresolved := &[]unresolvedMember{}
+			errs := &[]*rowError{}
+			extract := byLeader(found, errs)
+
+			if !test.byLeader {
+				extract = byMember(newMemberMatcher(dep), found, unresolved, errs)
+			}
+
+			next, err := s.scrapePage(extract, test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range *errs {
+				e.page = test.path
+			}
+
+			output, err := json.MarshalIndent(newGoldenPage(next, *found, *unresolved, *errs), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("fixtures", "meetings", "golden", strings.Replace(name, " ", "_", -1)+".json")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, append(output, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(expected) != string(output)+"\n" {
+				t.Errorf("expected %s to match %s, got:\n%s", test.path, golden, output)
+			}
+		})
+	}
+}
+
+// Write the page at u to fixtures/meetings, under its fixtureName.
+func recordPage(t *testing.T, u string) {
+	name, err := fixtureName(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := newHTTPFetcher(30*time.Second, defaultUserAgent).Fetch(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected %s to be 200 OK, got %s", u, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join("fixtures", "meetings", name), body, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
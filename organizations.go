@@ -3,99 +3,241 @@ package main
 import (
 	"database/sql"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"os"
+	"strings"
 
 	"github.com/lib/pq"
 )
 
+// An interestRepresentative in the register XML.
 type organization struct {
 	IdentificationCode string `xml:"identificationCode"`
 	Name               struct {
 		OriginalName string `xml:"originalName"`
 	} `xml:"name"`
 	ContactDetails struct {
-		Country     string `xml:"country"`
-		CountryCode int
+		AddressLine1 string `xml:"addressline1"`
+		AddressLine2 string `xml:"addressline2"`
+		PostCode     string `xml:"postCode"`
+		Town         string `xml:"town"`
+		Country      string `xml:"country"`
+		CountryCode  int
 	} `xml:"contactDetails"`
-	LegalStatus      string `xml:"legalStatus"`
-	RegistrationDate string `xml:"registrationDate"`
-	LastUpdateDate   string `xml:"lastUpdateDate"`
+	Category struct {
+		MainCategory string `xml:"mainCategory"`
+		SubCategory  string `xml:"subCategory"`
+	} `xml:"category"`
+	Goals      string `xml:"goals"`
+	WebSiteURL string `xml:"webSiteURL"`
+	Members    struct {
+		Persons int     `xml:"members"`
+		FTE     float64 `xml:"membersFTE"`
+	} `xml:"members"`
+	AccreditedPersons []accreditedPerson `xml:"accreditedPersons>accreditedPerson"`
+	Interests         []string           `xml:"interests>interest>name"`
+	FinancialData     financialData      `xml:"financialData"`
+	LegalStatus       string             `xml:"legalStatus"`
+	RegistrationDate  string             `xml:"registrationDate"`
+	LastUpdateDate    string             `xml:"lastUpdateDate"`
 }
 
-func processXML(file string, db *sql.DB) error {
-	f, err := os.Open(file)
+// A person with access to the European Parliament on behalf of an organization.
+type accreditedPerson struct {
+	FirstName string `xml:"firstName"`
+	LastName  string `xml:"lastName"`
+	StartDate string `xml:"startDate"`
+	EndDate   string `xml:"endDate"`
+}
+
+// The financial year that an organization last closed, as declared. Costs and
+// turnover are declared either as an amount or as a range such as
+// "100000 - 199999", so they are kept as text.
+type financialData struct {
+	ClosedYear struct {
+		StartDate string `xml:"startDate"`
+		EndDate   string `xml:"endDate"`
+	} `xml:"closedYear"`
+	Costs       string `xml:"financialInformation>costs"`
+	Turnover    string `xml:"financialInformation>turnover"`
+	Grants      string `xml:"financialInformation>eurSourcesGrants"`
+	Procurement string `xml:"financialInformation>eurSourcesProcurement"`
+	Other       string `xml:"financialInformation>otherSources"`
+}
+
+// Number of organizations that are upserted at once.
+const organizationBatch = 1000
+
+// What to do with an interestRepresentative that can not be decoded.
+type decodePolicy int
+
+const (
+	// Stop the import at the first invalid interestRepresentative.
+	abortOnError decodePolicy = iota
+	// Leave out invalid interestRepresentatives and report them afterwards.
+	skipOnError
+)
+
+// Returns the policy for the name used by the -on-error flag.
+func parseDecodePolicy(name string) (decodePolicy, error) {
+	switch name {
+	case "abort":
+		return abortOnError, nil
+	case "skip":
+		return skipOnError, nil
+	}
+
+	return abortOnError, fmt.Errorf("unknown policy %q, expected abort or skip", name)
+}
+
+// An error in the register XML, with the byte offset at which it occurred
+// and the last interestRepresentative that was decoded before it.
+type decodeError struct {
+	offset   int64
+	lastCode string
+	err      error
+}
+
+func (e *decodeError) Error() string {
+	last := e.lastCode
+	if last == "" {
+		last = "none"
+	}
+
+	return fmt.Sprintf("byte %d, after %s: %v", e.offset, last, e.err)
+}
+
+// Returns an error if fields that are required by the organizations table
+// are missing.
+func (org *organization) validate() error {
+	switch {
+	case org.IdentificationCode == "":
+		return errors.New("missing identificationCode")
+	case org.Name.OriginalName == "":
+		return fmt.Errorf("%s: missing originalName", org.IdentificationCode)
+	case org.RegistrationDate == "":
+		return fmt.Errorf("%s: missing registrationDate", org.IdentificationCode)
+	case org.LastUpdateDate == "":
+		return fmt.Errorf("%s: missing lastUpdateDate", org.IdentificationCode)
+	}
+
+	return nil
+}
+
+// Options for an import of the register XML.
+type importOptions struct {
+	policy decodePolicy
+	// Percentage of registered organizations that may be missing from a
+	// complete import before deregistering them is refused.
+	maxVanish float64
+	dryRun    bool
+	// The register is an archived snapshot, which lacks the organizations
+	// that registered after it, so none are deregistered.
+	replay bool
+}
+
+// Import the register in r, which may be compressed, see decompress.
+func importRegister(r io.Reader, db *sql.DB, run *importRun, opts importOptions) error {
+	plain, err := decompress(r)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
+	err = processXML(plain, db, run, opts)
 
+	// Closing stops xz from reading r, which the caller may read further.
+	if cerr := plain.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Decode the organizations in the register XML read from r, and upsert them
+// in batches while the XML is read. Every organization is marked with the ID
+// of the run it was last seen in. After a complete import that is not a
+// replay, organizations that were not seen are marked as deregistered.
+func processXML(r io.Reader, db *sql.DB, run *importRun, opts importOptions) error {
 	countries, err := countryNameToID(db)
 	if err != nil {
 		return err
 	}
 
-	orgs := &[]organization{}
-	dec := xml.NewDecoder(f)
-
 	// Counter tracks interestRepresentatives.
 	var counter int64
 
-	for {
-		// Stream and read tokens from the .xml file.
-		t, _ := dec.Token()
-		if t == nil {
-			break
+	skipped, err := decodeOrganizations(r, organizationBatch, opts.policy, func(orgs []organization) error {
+		for i, org := range orgs {
+			if code, ok := countries[org.ContactDetails.Country]; ok {
+				orgs[i].ContactDetails.CountryCode = code
+			} else {
+				// throw proper error, could not find country
+				log.Printf(
+					"could not find '%s', in the country_names table",
+					org.ContactDetails.Country,
+				)
+			}
 		}
 
-		switch se := t.(type) {
-		case xml.StartElement:
-			if se.Name.Local == "interestRepresentative" {
-				var org organization
+		counter += int64(len(orgs))
 
-				dec.DecodeElement(&org, &se)
+		if opts.dryRun {
+			return nil
+		}
 
-				if code, ok := countries[org.ContactDetails.Country]; ok {
-					org.ContactDetails.CountryCode = code
-				} else {
-					// throw proper error, could not find country
-					log.Printf(
-						"could not find '%s', in the country_names table",
-						org.ContactDetails.Country,
-					)
-				}
+		return bulkUpsertOrganizations(&orgs, run, db)
+	})
 
-				// Bulk upsert every 1000 rows.
-				if counter%1000 == 0 && counter != 0 {
-					err := bulkUpsertOrganizations(orgs, db)
-					if err != nil {
-						return err
-					}
+	for _, e := range skipped {
+		log.Printf("skipped interestRepresentative at %v\n", e)
+		run.fail(e)
+	}
 
-					orgs = &[]organization{}
-				}
+	run.count(0, int64(len(skipped)))
 
-				*orgs = append(*orgs, org)
+	if len(skipped) != 0 {
+		log.Printf("skipped %d of %d interestRepresentatives\n", len(skipped), counter+int64(len(skipped)))
+	}
 
-				counter++
-			}
-		}
+	if err != nil {
+		return err
 	}
 
-	// Upsert the remainder
-	if len(*orgs) != 0 {
-		err := bulkUpsertOrganizations(orgs, db)
-		if err != nil {
-			return err
-		}
+	if opts.dryRun {
+		log.Printf("dry run, would upsert %d organizations\n", counter)
+		return nil
 	}
 
-	return nil
+	linked, err := linkPendingMeetings(db)
+	if err != nil {
+		return err
+	}
+
+	if linked != 0 {
+		log.Printf("linked %d meeting entities to organizations that joined the register\n", linked)
+	}
+
+	// Organizations that were skipped were not seen either, so only a
+	// complete import can tell which organizations left the register.
+	if len(skipped) != 0 {
+		log.Printf("run %d is incomplete, not checking for deregistered organizations\n", run.id)
+		return nil
+	}
+
+	if opts.replay {
+		log.Printf("run %d is a replay, not checking for deregistered organizations\n", run.id)
+		return nil
+	}
+
+	return deregisterOrganizations(db, run, opts.maxVanish)
 }
 
-func bulkUpsertOrganizations(orgs *[]organization, db *sql.DB) error {
-	// Start transaction.
+// Mark registered organizations that were not seen in the import as
+// deregistered. It refuses if more than maxVanish percent of them would be,
+// as that more likely means the register was not exported completely.
+func deregisterOrganizations(db *sql.DB, run *importRun, maxVanish float64) error {
 	txn, err := db.Begin()
 	if err != nil {
 		return err
@@ -110,75 +252,415 @@ func bulkUpsertOrganizations(orgs *[]organization, db *sql.DB) error {
 		}
 	}()
 
-	// Create a temporary table that is dropped on commit.
-	// It allows for a INSERT INTO ... ON CONFLICT
-	_, err = txn.Exec(`CREATE TEMP TABLE organizations_temp (
-		organization_id             TEXT NOT NULL,
-		organization_name           TEXT NOT NULL,
-		organization_country				INT  NOT NULL,
-		organization_legal_status   TEXT NOT NULL,
-		organization_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-		organization_registered_at  TIMESTAMP WITH TIME ZONE NOT NULL
-	)	ON COMMIT DROP`)
+	var registered, vanished int64
+
+	err = txn.QueryRow(`
+		SELECT count(*), count(*) FILTER (WHERE organization_last_seen_import IS DISTINCT FROM $1)
+		FROM organizations
+		WHERE organization_deregistered_at IS NULL`,
+		run.id,
+	).Scan(&registered, &vanished)
+	if err != nil {
+		return err
+	}
+
+	if err := checkVanished(vanished, registered, maxVanish); err != nil {
+		return err
+	}
+
+	rows, err := txn.Query(`
+		UPDATE organizations SET organization_deregistered_at = now()
+		WHERE organization_deregistered_at IS NULL
+		AND organization_last_seen_import IS DISTINCT FROM $1
+		RETURNING organization_id`,
+		run.id,
+	)
 	if err != nil {
 		return err
 	}
 
-	stmt, err := txn.Prepare(pq.CopyIn("organizations_temp",
-		"organization_id",
-		"organization_name",
-		"organization_country",
-		"organization_legal_status",
-		"organization_updated_at",
-		"organization_registered_at",
-	))
+	ids, err := scanStrings(rows)
 	if err != nil {
 		return err
 	}
 
-	// Copy into temporary table
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	success = true
+
+	for _, id := range ids {
+		run.change("deregistered", id)
+	}
+
+	log.Printf("deregistered %d of %d organizations\n", vanished, registered)
+
+	return nil
+}
+
+// Returns an error if more than max percent of the registered organizations
+// vanished from the register.
+func checkVanished(vanished, registered int64, max float64) error {
+	if registered == 0 {
+		return nil
+	}
+
+	if pct := float64(vanished) / float64(registered) * 100; pct > max {
+		return fmt.Errorf("refusing to deregister %d of %d organizations (%.1f%%), the maximum is %g%%", vanished, registered, pct, max)
+	}
+
+	return nil
+}
+
+// Stream the interestRepresentatives in the XML read from r, and call fn with
+// each batch of at most size organizations. Invalid interestRepresentatives
+// are returned when the policy is to skip them. Syntax errors always stop the
+// import, as the decoder can not continue after them, which is also how a
+// truncated download shows up.
+func decodeOrganizations(r io.Reader, size int, policy decodePolicy, fn func([]organization) error) ([]*decodeError, error) {
+	skipped := []*decodeError{}
+	orgs := []organization{}
+	dec := xml.NewDecoder(r)
+
+	// Code of the last interestRepresentative that was decoded.
+	var last string
+
+	for {
+		// Stream and read tokens from the .xml file.
+		t, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return skipped, &decodeError{dec.InputOffset(), last, err}
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			if se.Name.Local == "interestRepresentative" {
+				var org organization
+
+				offset := dec.InputOffset()
+
+				err := dec.DecodeElement(&org, &se)
+				if _, ok := err.(*xml.SyntaxError); ok {
+					return skipped, &decodeError{dec.InputOffset(), last, err}
+				}
+				if err == nil {
+					err = org.validate()
+				}
+				if err != nil {
+					if policy == abortOnError {
+						return skipped, &decodeError{offset, last, err}
+					}
+
+					skipped = append(skipped, &decodeError{offset, last, err})
+					continue
+				}
+
+				last = org.IdentificationCode
+
+				orgs = append(orgs, org)
+
+				if len(orgs) == size {
+					if err := fn(orgs); err != nil {
+						return skipped, err
+					}
+
+					orgs = []organization{}
+				}
+			}
+		}
+	}
+
+	// Pass on the remainder
+	if len(orgs) != 0 {
+		return skipped, fn(orgs)
+	}
+
+	return skipped, nil
+}
+
+// Upsert organizations and replace their financial data, accreditations and
+// interests with those in the register.
+func bulkUpsertOrganizations(orgs *[]organization, run *importRun, db *sql.DB) error {
+	orgRows := [][]interface{}{}
+	accreditationRows := [][]interface{}{}
+	interestRows := [][]interface{}{}
+	financialRows := [][]interface{}{}
+
 	for _, org := range *orgs {
-		_, err := stmt.Exec(
+		c := org.ContactDetails
+		address := strings.TrimSpace(c.AddressLine1 + "\n" + c.AddressLine2)
+
+		orgRows = append(orgRows, []interface{}{
 			org.IdentificationCode,
 			org.Name.OriginalName,
-			org.ContactDetails.CountryCode,
+			c.CountryCode,
 			org.LegalStatus,
 			org.LastUpdateDate,
 			org.RegistrationDate,
-		)
+			org.Category.MainCategory,
+			org.Category.SubCategory,
+			org.Goals,
+			org.WebSiteURL,
+			address,
+			c.PostCode,
+			c.Town,
+			org.Members.Persons,
+			org.Members.FTE,
+		})
+
+		f := org.FinancialData
+
+		fy, ok, err := declaredYear(f)
 		if err != nil {
-			return err
+			log.Printf("%s: %v\n", org.IdentificationCode, err)
+		}
+		if ok {
+			financialRows = append(financialRows, []interface{}{
+				org.IdentificationCode, fy.year, fy.start, fy.end, strings.TrimSpace(f.Costs),
+				fy.costsLower, fy.costsUpper, fy.grants, fy.other,
+				strings.TrimSpace(f.Turnover), strings.TrimSpace(f.Procurement),
+			})
+		}
+
+		for _, p := range org.AccreditedPersons {
+			accreditationRows = append(accreditationRows, []interface{}{
+				org.IdentificationCode, p.FirstName, p.LastName, p.StartDate, p.EndDate,
+			})
+		}
+
+		for _, i := range org.Interests {
+			if i = strings.TrimSpace(i); i != "" {
+				interestRows = append(interestRows, []interface{}{org.IdentificationCode, i})
+			}
 		}
 	}
 
-	_, err = stmt.Exec()
+	// Start transaction.
+	txn, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	err = stmt.Close()
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	// Create temporary tables that are dropped on commit.
+	// They allow for a INSERT INTO ... ON CONFLICT
+	_, err = txn.Exec(`
+		CREATE TEMP TABLE organizations_temp (
+			organization_id             TEXT NOT NULL,
+			organization_name           TEXT NOT NULL,
+			organization_country        INT  NOT NULL,
+			organization_legal_status   TEXT NOT NULL,
+			organization_updated_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+			organization_registered_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+			organization_category       TEXT NOT NULL,
+			organization_subsection     TEXT NOT NULL,
+			organization_goals          TEXT NOT NULL,
+			organization_website        TEXT NOT NULL,
+			organization_address        TEXT NOT NULL,
+			organization_post_code      TEXT NOT NULL,
+			organization_city           TEXT NOT NULL,
+			organization_persons        INT  NOT NULL,
+			organization_persons_fte    REAL NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE organization_financials_temp (
+			organization_id             TEXT    NOT NULL,
+			financial_year              INT     NOT NULL,
+			financial_year_start        TEXT    NOT NULL,
+			financial_year_end          TEXT    NOT NULL,
+			financial_costs             TEXT    NOT NULL,
+			financial_costs_lower       NUMERIC,
+			financial_costs_upper       NUMERIC,
+			financial_eu_grants         NUMERIC,
+			financial_other_funding     NUMERIC,
+			financial_turnover          TEXT    NOT NULL,
+			financial_procurement       TEXT    NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE organization_accreditations_temp (
+			organization_id             TEXT NOT NULL,
+			accreditation_first_name    TEXT NOT NULL,
+			accreditation_last_name     TEXT NOT NULL,
+			accreditation_start_date    TEXT NOT NULL,
+			accreditation_end_date      TEXT NOT NULL
+		) ON COMMIT DROP;
+
+		CREATE TEMP TABLE organization_interests_temp (
+			organization_id             TEXT NOT NULL,
+			interest_name               TEXT NOT NULL
+		) ON COMMIT DROP;
+	`)
 	if err != nil {
 		return err
 	}
 
-	// Insert from temp to real table
-	_, err = txn.Exec(`
-		INSERT INTO organizations
-		SELECT * FROM organizations_temp
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"organizations_temp", []string{
+			"organization_id", "organization_name", "organization_country", "organization_legal_status",
+			"organization_updated_at", "organization_registered_at", "organization_category", "organization_subsection",
+			"organization_goals", "organization_website", "organization_address", "organization_post_code",
+			"organization_city", "organization_persons", "organization_persons_fte",
+		}, orgRows},
+		{"organization_financials_temp", []string{
+			"organization_id", "financial_year", "financial_year_start", "financial_year_end", "financial_costs",
+			"financial_costs_lower", "financial_costs_upper", "financial_eu_grants", "financial_other_funding",
+			"financial_turnover", "financial_procurement",
+		}, financialRows},
+		{"organization_accreditations_temp", []string{
+			"organization_id", "accreditation_first_name", "accreditation_last_name",
+			"accreditation_start_date", "accreditation_end_date",
+		}, accreditationRows},
+		{"organization_interests_temp", []string{"organization_id", "interest_name"}, interestRows},
+	}
+
+	for _, c := range copies {
+		if err := copyRows(txn, c.table, c.columns, c.rows); err != nil {
+			return fmt.Errorf("could not copy into %s: %v", c.table, err)
+		}
+	}
+
+	// Insert from temp to real table. Records with the same update date are
+	// updated if they differ, so columns that were added later are filled in.
+	rows, err := txn.Query(`
+		INSERT INTO organizations (
+			organization_id, organization_name, organization_country, organization_legal_status,
+			organization_updated_at, organization_registered_at, organization_category, organization_subsection,
+			organization_goals, organization_website, organization_address, organization_post_code,
+			organization_city, organization_persons, organization_persons_fte
+		)
+		SELECT
+			organization_id, organization_name, organization_country, organization_legal_status,
+			organization_updated_at, organization_registered_at, NULLIF(organization_category, ''), NULLIF(organization_subsection, ''),
+			NULLIF(organization_goals, ''), NULLIF(organization_website, ''), NULLIF(organization_address, ''), NULLIF(organization_post_code, ''),
+			NULLIF(organization_city, ''), organization_persons, organization_persons_fte
+		FROM organizations_temp
 		ON CONFLICT (organization_id)
 		DO UPDATE SET
-			organization_id	= EXCLUDED.organization_id,
 			organization_name = EXCLUDED.organization_name,
 			organization_legal_status = EXCLUDED.organization_legal_status,
 			organization_country = EXCLUDED.organization_country,
 			organization_updated_at = EXCLUDED.organization_updated_at,
-			organization_registered_at = EXCLUDED.organization_registered_at
+			organization_registered_at = EXCLUDED.organization_registered_at,
+			organization_category = EXCLUDED.organization_category,
+			organization_subsection = EXCLUDED.organization_subsection,
+			organization_goals = EXCLUDED.organization_goals,
+			organization_website = EXCLUDED.organization_website,
+			organization_address = EXCLUDED.organization_address,
+			organization_post_code = EXCLUDED.organization_post_code,
+			organization_city = EXCLUDED.organization_city,
+			organization_persons = EXCLUDED.organization_persons,
+			organization_persons_fte = EXCLUDED.organization_persons_fte
 		WHERE EXCLUDED.organization_updated_at > organizations.organization_updated_at
+		OR (EXCLUDED.organization_updated_at = organizations.organization_updated_at AND (
+			organizations.organization_name, organizations.organization_country, organizations.organization_legal_status,
+			organizations.organization_registered_at, organizations.organization_category, organizations.organization_subsection,
+			organizations.organization_goals, organizations.organization_website, organizations.organization_address,
+			organizations.organization_post_code, organizations.organization_city, organizations.organization_persons,
+			organizations.organization_persons_fte
+		) IS DISTINCT FROM (
+			EXCLUDED.organization_name, EXCLUDED.organization_country, EXCLUDED.organization_legal_status,
+			EXCLUDED.organization_registered_at, EXCLUDED.organization_category, EXCLUDED.organization_subsection,
+			EXCLUDED.organization_goals, EXCLUDED.organization_website, EXCLUDED.organization_address,
+			EXCLUDED.organization_post_code, EXCLUDED.organization_city, EXCLUDED.organization_persons,
+			EXCLUDED.organization_persons_fte
+		))
+		RETURNING organization_id, xmax = 0
 	`)
 	if err != nil {
 		return err
 	}
 
+	changes, err := scanChanges(rows)
+	if err != nil {
+		return err
+	}
+
+	// Mark every organization in the batch as seen, including those that did
+	// not change. Organizations that return to the register are registered.
+	_, err = txn.Exec(`
+		UPDATE organizations SET
+			organization_last_seen_import = $1,
+			organization_deregistered_at = NULL
+		FROM organizations_temp
+		WHERE organizations.organization_id = organizations_temp.organization_id`,
+		run.id,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Replace the accreditations and interests, and the declared year, of the
+	// organizations that were inserted or updated. Those of organizations of
+	// which the register has an older record, such as in a replay, are kept.
+	ids := make([]string, len(changes))
+	for i, c := range changes {
+		ids[i] = c.key
+	}
+
+	statements := []string{
+		`DELETE FROM organization_accreditations WHERE organization_id = ANY($1)`,
+		`DELETE FROM organization_interests WHERE organization_id = ANY($1)`,
+		`INSERT INTO organization_accreditations (
+			organization_id, accreditation_first_name, accreditation_last_name,
+			accreditation_start_date, accreditation_end_date
+		)
+		SELECT DISTINCT ON (organization_id, accreditation_first_name, accreditation_last_name)
+			organization_id, accreditation_first_name, accreditation_last_name,
+			NULLIF(accreditation_start_date, '')::DATE, NULLIF(accreditation_end_date, '')::DATE
+		FROM organization_accreditations_temp
+		WHERE organization_id = ANY($1)
+		ORDER BY organization_id, accreditation_first_name, accreditation_last_name, accreditation_start_date DESC`,
+		`INSERT INTO organization_interests (organization_id, interest_name)
+		SELECT DISTINCT organization_id, interest_name
+		FROM organization_interests_temp
+		WHERE organization_id = ANY($1)`,
+		// Financial years are kept, so a declaration only replaces the one
+		// for the same year.
+		`INSERT INTO organization_financials (
+			organization_id, financial_year, financial_year_start, financial_year_end, financial_costs,
+			financial_costs_lower, financial_costs_upper, financial_eu_grants, financial_other_funding,
+			financial_turnover, financial_procurement
+		)
+		SELECT DISTINCT ON (organization_id, financial_year)
+			organization_id, financial_year, NULLIF(financial_year_start, '')::DATE, financial_year_end::DATE, NULLIF(financial_costs, ''),
+			financial_costs_lower, financial_costs_upper, financial_eu_grants, financial_other_funding,
+			NULLIF(financial_turnover, ''), NULLIF(financial_procurement, '')
+		FROM organization_financials_temp
+		WHERE organization_id = ANY($1)
+		ON CONFLICT (organization_id, financial_year) DO UPDATE SET
+			financial_year_start = EXCLUDED.financial_year_start,
+			financial_year_end = EXCLUDED.financial_year_end,
+			financial_costs = EXCLUDED.financial_costs,
+			financial_costs_lower = EXCLUDED.financial_costs_lower,
+			financial_costs_upper = EXCLUDED.financial_costs_upper,
+			financial_eu_grants = EXCLUDED.financial_eu_grants,
+			financial_other_funding = EXCLUDED.financial_other_funding,
+			financial_turnover = EXCLUDED.financial_turnover,
+			financial_procurement = EXCLUDED.financial_procurement`,
+	}
+
+	for _, query := range statements {
+		if _, err := txn.Exec(query, pq.Array(ids)); err != nil {
+			return err
+		}
+	}
+
 	err = txn.Commit()
 	if err != nil {
 		return err
@@ -186,9 +668,60 @@ func bulkUpsertOrganizations(orgs *[]organization, db *sql.DB) error {
 
 	success = true
 
+	for _, c := range changes {
+		run.change(c.kind, c.key)
+	}
+
+	run.count(int64(len(*orgs)-len(changes)), 0)
+
 	return nil
 }
 
+// Returns the changes of an upsert that returns the key of each inserted or
+// updated row, and whether it was inserted.
+func scanChanges(rows *sql.Rows) ([]runChange, error) {
+	defer rows.Close()
+
+	changes := []runChange{}
+
+	for rows.Next() {
+		var key string
+		var inserted bool
+
+		if err := rows.Scan(&key, &inserted); err != nil {
+			return changes, err
+		}
+
+		kind := "updated"
+		if inserted {
+			kind = "inserted"
+		}
+
+		changes = append(changes, runChange{kind, key})
+	}
+
+	return changes, rows.Err()
+}
+
+// Returns the values of a query with a single text column.
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	values := []string{}
+
+	for rows.Next() {
+		var v string
+
+		if err := rows.Scan(&v); err != nil {
+			return values, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
 // Returns a map of country names to the corresponding ID in the database.
 func countryNameToID(db *sql.DB) (map[string]int, error) {
 	countries := map[string]int{}
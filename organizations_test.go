@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const registerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<ListOfIRPublicDetail>
+  <resultList>
+    <interestRepresentative>
+      <identificationCode>03181945560-59</identificationCode>
+      <registrationDate>2011-09-12T17:32:54.000+02:00</registrationDate>
+      <name><originalName>Google</originalName></name>
+      <legalStatus>Limited Company</legalStatus>
+      <webSiteURL>https://www.google.com</webSiteURL>
+      <contactDetails>
+        <addressline1>1600 Amphitheatre Parkway</addressline1>
+        <addressline2></addressline2>
+        <postCode>94043</postCode>
+        <town>Mountain View</town>
+        <country>UNITED STATES</country>
+      </contactDetails>
+      <category>
+        <mainCategory>II - In-house lobbyists and trade/business/professional associations</mainCategory>
+        <subCategory>Companies &amp; groups</subCategory>
+      </category>
+      <goals>Organize the world's information.</goals>
+      <members><members>15</members><membersFTE>6.5</membersFTE></members>
+      <accreditedPersons>
+        <accreditedPerson><firstName>Jane</firstName><lastName>Doe</lastName><startDate>2018-02-01</startDate><endDate>2019-01-31</endDate></accreditedPerson>
+      </accreditedPersons>
+      <interests>
+        <interest><name>Competition</name></interest>
+        <interest><name>Digital economy and society</name></interest>
+      </interests>
+      <financialData>
+        <closedYear><startDate>2017-01-01</startDate><endDate>2017-12-31</endDate></closedYear>
+        <financialInformation>
+          <costs>6000000 - 6249999</costs>
+          <eurSourcesGrants>0</eurSourcesGrants>
+          <eurSourcesProcurement>0</eurSourcesProcurement>
+        </financialInformation>
+      </financialData>
+      <lastUpdateDate>2018-08-29T16:50:11.000+02:00</lastUpdateDate>
+    </interestRepresentative>
+    <interestRepresentative>
+      <identificationCode>3978240953-79</identificationCode>
+      <registrationDate>2008-09-10T17:33:41.000+02:00</registrationDate>
+      <name><originalName>BusinessEurope</originalName></name>
+      <legalStatus>AISBL</legalStatus>
+      <contactDetails><country>BELGIUM</country></contactDetails>
+      <lastUpdateDate>2018-05-14T10:12:01.000+02:00</lastUpdateDate>
+    </interestRepresentative>
+    <interestRepresentative>
+      <identificationCode>9832909575-41</identificationCode>
+      <registrationDate>2008-10-20T11:02:09.000+02:00</registrationDate>
+      <name><originalName>Greenpeace European Unit</originalName></name>
+      <legalStatus>Stichting</legalStatus>
+      <contactDetails><country>BELGIUM</country></contactDetails>
+      <lastUpdateDate>2018-07-02T09:47:30.000+02:00</lastUpdateDate>
+    </interestRepresentative>
+  </resultList>
+</ListOfIRPublicDetail>`
+
+func TestDecodeOrganizations(t *testing.T) {
+	tests := map[string]struct {
+		size     int
+		expected [][]string
+	}{
+		"single batch":  {1000, [][]string{{"Google", "BusinessEurope", "Greenpeace European Unit"}}},
+		"remainder":     {2, [][]string{{"Google", "BusinessEurope"}, {"Greenpeace European Unit"}}},
+		"exact batches": {3, [][]string{{"Google", "BusinessEurope", "Greenpeace European Unit"}}},
+		"one at a time": {1, [][]string{{"Google"}, {"BusinessEurope"}, {"Greenpeace European Unit"}}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := [][]string{}
+
+			_, err := decodeOrganizations(strings.NewReader(registerXML), test.size, abortOnError, func(orgs []organization) error {
+				names := []string{}
+				for _, org := range orgs {
+					names = append(names, org.Name.OriginalName)
+				}
+
+				output = append(output, names)
+
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(output, test.expected) {
+				t.Errorf("expected batches to be %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestDecodeOrganizationsErrors(t *testing.T) {
+	// The second interestRepresentative without its identificationCode.
+	missing := strings.Replace(registerXML, "<identificationCode>3978240953-79</identificationCode>", "", 1)
+
+	// The download stopped halfway through the third interestRepresentative.
+	truncated := registerXML[:strings.Index(registerXML, "Greenpeace")]
+
+	// Offset right after the start tag of the second interestRepresentative.
+	tag := "<interestRepresentative>"
+	second := strings.Index(missing, tag) + len(tag)
+	second += strings.Index(missing[second:], tag) + len(tag)
+
+	tests := map[string]struct {
+		xml      string
+		policy   decodePolicy
+		decoded  int
+		skipped  []string
+		expected string
+	}{
+		"complete": {registerXML, abortOnError, 3, []string{}, ""},
+		"abort on missing field": {
+			missing, abortOnError, 0, []string{},
+			fmt.Sprintf("byte %d, after 03181945560-59: missing identificationCode", second),
+		},
+		"skip missing field": {
+			missing, skipOnError, 2, []string{"missing identificationCode"}, "",
+		},
+		"truncated": {
+			truncated, skipOnError, 0, []string{},
+			fmt.Sprintf("byte %d, after 3978240953-79: XML syntax error on line %d: unexpected EOF", len(truncated), strings.Count(truncated, "\n")+1),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var decoded int
+
+			skipped, err := decodeOrganizations(strings.NewReader(test.xml), 1000, test.policy, func(orgs []organization) error {
+				decoded += len(orgs)
+				return nil
+			})
+
+			var output string
+			if err != nil {
+				output = err.Error()
+			}
+
+			if output != test.expected {
+				t.Errorf("expected error to be %q, got %q", test.expected, output)
+			}
+
+			if decoded != test.decoded {
+				t.Errorf("expected %d decoded organizations, got %d", test.decoded, decoded)
+			}
+
+			reasons := []string{}
+			for _, e := range skipped {
+				reasons = append(reasons, e.err.Error())
+			}
+
+			if !reflect.DeepEqual(reasons, test.skipped) {
+				t.Errorf("expected skipped to be %q, got %q", test.skipped, reasons)
+			}
+		})
+	}
+}
+
+func TestDecodeOrganizationDetails(t *testing.T) {
+	var google organization
+
+	_, err := decodeOrganizations(strings.NewReader(registerXML), 1000, abortOnError, func(orgs []organization) error {
+		google = orgs[0]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		output   interface{}
+		expected interface{}
+	}{
+		"town":          {google.ContactDetails.Town, "Mountain View"},
+		"post code":     {google.ContactDetails.PostCode, "94043"},
+		"subsection":    {google.Category.SubCategory, "Companies & groups"},
+		"website":       {google.WebSiteURL, "https://www.google.com"},
+		"persons":       {google.Members.Persons, 15},
+		"fte":           {google.Members.FTE, 6.5},
+		"accreditation": {google.AccreditedPersons, []accreditedPerson{{"Jane", "Doe", "2018-02-01", "2019-01-31"}}},
+		"interests":     {google.Interests, []string{"Competition", "Digital economy and society"}},
+		"year":          {google.FinancialData.ClosedYear.EndDate, "2017-12-31"},
+		"costs":         {google.FinancialData.Costs, "6000000 - 6249999"},
+		"grants":        {google.FinancialData.Grants, "0"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.output, test.expected) {
+				t.Errorf("expected %s to be %v, got %v", name, test.expected, test.output)
+			}
+		})
+	}
+}
+
+func TestCheckVanished(t *testing.T) {
+	tests := map[string]struct {
+		vanished   int64
+		registered int64
+		max        float64
+		expected   bool
+	}{
+		"none vanished":  {0, 11000, 5, true},
+		"below maximum":  {120, 11000, 5, true},
+		"at maximum":     {550, 11000, 5, true},
+		"above maximum":  {551, 11000, 5, false},
+		"empty register": {0, 0, 5, true},
+		"zero maximum":   {1, 11000, 0, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := checkVanished(test.vanished, test.registered, test.max); (err == nil) != test.expected {
+				t.Errorf("expected %d of %d to be allowed to be %t, got %v", test.vanished, test.registered, test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Width of the progress bar, in characters.
+const progressBarWidth = 30
+
+// How often the progress is redrawn on a terminal, and logged otherwise.
+const (
+	progressBarTick = 500 * time.Millisecond
+	progressLogTick = 10 * time.Second
+)
+
+// An io.Writer that counts the bytes of a download written through it, and
+// reports the progress at a fixed tick. On a terminal the progress is shown as a
+// bar that is redrawn in place, otherwise it is logged as key=value pairs.
+type progress struct {
+	written int64 // Accessed atomically.
+	total   int64 // Expected bytes, or -1 if unknown.
+	start   time.Time
+	offset  int64 // Bytes that were downloaded before, for a resumed download.
+
+	out  io.Writer
+	tty  bool
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Start reporting the progress of a download of total bytes, which is -1 if
+// unknown, to out. A resumed download starts at offset.
+func newProgress(out *os.File, offset, total int64) *progress {
+	p := &progress{
+		written: offset,
+		total:   total,
+		start:   time.Now(),
+		offset:  offset,
+		out:     out,
+		tty:     isTerminal(out),
+		done:    make(chan struct{}),
+	}
+
+	tick := progressLogTick
+	if p.tty {
+		tick = progressBarTick
+	}
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.report(time.Now())
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// Returns whether f is a terminal, rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.written, int64(len(b)))
+	return len(b), nil
+}
+
+// Stop reporting, and report the final progress.
+func (p *progress) Stop() {
+	close(p.done)
+	p.wg.Wait()
+
+	p.report(time.Now())
+
+	// Move past the bar once the download finishes.
+	if p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progress) report(now time.Time) {
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s", p.bar(now))
+	} else {
+		log.Print(p.line(now))
+	}
+}
+
+// Returns the bytes per second since the start, and the estimated time until
+// the download finishes, which is -1 if unknown.
+func (p *progress) rate(now time.Time) (float64, time.Duration) {
+	written := atomic.LoadInt64(&p.written)
+
+	elapsed := now.Sub(p.start).Seconds()
+	if elapsed <= 0 {
+		return 0, -1
+	}
+
+	rate := float64(written-p.offset) / elapsed
+
+	if p.total < 0 || rate <= 0 {
+		return rate, -1
+	}
+
+	eta := time.Duration(float64(p.total-written) / rate * float64(time.Second))
+
+	return rate, eta.Round(time.Second)
+}
+
+// Returns the progress as a bar, for example:
+//
+//	[=========>                    ]  33%  9.0 MiB / 27.0 MiB  1.5 MiB/s  ETA 12s
+func (p *progress) bar(now time.Time) string {
+	written := atomic.LoadInt64(&p.written)
+	rate, eta := p.rate(now)
+
+	if p.total <= 0 {
+		return fmt.Sprintf("%s  %s/s", humanBytes(uint64(written)), humanBytes(uint64(rate)))
+	}
+
+	pct := float64(written) / float64(p.total)
+	if pct > 1 {
+		pct = 1
+	}
+
+	filled := int(pct * progressBarWidth)
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	return fmt.Sprintf(
+		"[%s] %3.0f%%  %s / %s  %s/s  ETA %s",
+		bar, pct*100, humanBytes(uint64(written)), humanBytes(uint64(p.total)), humanBytes(uint64(rate)), formatETA(eta),
+	)
+}
+
+// Returns the progress as a log line, for example:
+//
+//	download bytes=9437184 total=28311552 percent=33.3 rate=1572864 eta=12s
+//
+// The rate is in bytes per second.
+func (p *progress) line(now time.Time) string {
+	written := atomic.LoadInt64(&p.written)
+	rate, eta := p.rate(now)
+
+	if p.total <= 0 {
+		return fmt.Sprintf("download bytes=%d rate=%.0f", written, rate)
+	}
+
+	return fmt.Sprintf(
+		"download bytes=%d total=%d percent=%.1f rate=%.0f eta=%s",
+		written, p.total, float64(written)/float64(p.total)*100, rate, formatETA(eta),
+	)
+}
+
+func formatETA(eta time.Duration) string {
+	if eta < 0 {
+		return "unknown"
+	}
+
+	return eta.String()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressFormat(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		offset  int64
+		written int64
+		total   int64
+		bar     string
+		line    string
+	}{
+		"started": {
+			0, 0, 4 << 20,
+			"[>                             ]   0%  0 bytes / 4.0 MiB  0 bytes/s  ETA unknown",
+			"download bytes=0 total=4194304 percent=0.0 rate=0 eta=unknown",
+		},
+		"halfway": {
+			0, 2 << 20, 4 << 20,
+			"[===============>              ]  50%  2.0 MiB / 4.0 MiB  1.0 MiB/s  ETA 2s",
+			"download bytes=2097152 total=4194304 percent=50.0 rate=1048576 eta=2s",
+		},
+		"resumed": {
+			2 << 20, 3 << 20, 4 << 20,
+			"[======================>       ]  75%  3.0 MiB / 4.0 MiB  0.5 MiB/s  ETA 2s",
+			"download bytes=3145728 total=4194304 percent=75.0 rate=524288 eta=2s",
+		},
+		"finished": {
+			0, 4 << 20, 4 << 20,
+			"[==============================] 100%  4.0 MiB / 4.0 MiB  2.0 MiB/s  ETA 0s",
+			"download bytes=4194304 total=4194304 percent=100.0 rate=2097152 eta=0s",
+		},
+		"unknown length": {
+			0, 2 << 20, -1,
+			"2.0 MiB  1.0 MiB/s",
+			"download bytes=2097152 rate=1048576",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &progress{written: test.written, total: test.total, start: start, offset: test.offset}
+			now := start.Add(2 * time.Second)
+
+			if output := p.bar(now); output != test.bar {
+				t.Errorf("expected bar to be %q, got %q", test.bar, output)
+			}
+
+			if output := p.line(now); output != test.line {
+				t.Errorf("expected line to be %q, got %q", test.line, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Returns the delay before the given retry, starting at 0.
+type backoff func(retry int) time.Duration
+
+// Exponential backoff with full jitter, so concurrent workers that fail at
+// the same time do not retry at the same time.
+func exponentialBackoff(base, max time.Duration) backoff {
+	return func(retry int) time.Duration {
+		d := max
+		if retry < 32 && base<<uint(retry) < max {
+			d = base << uint(retry)
+		}
+
+		return time.Duration(rand.Int63n(int64(d))) + 1
+	}
+}
+
+// An error that is worth retrying, optionally after a delay given by the server.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func retryable(err error, after time.Duration) error {
+	return &retryableError{err, after}
+}
+
+type retrier struct {
+	attempts int
+	backoff  backoff
+	sleep    func(time.Duration)
+}
+
+func newRetrier(attempts int) *retrier {
+	return &retrier{
+		attempts: attempts,
+		backoff:  exponentialBackoff(time.Second, time.Minute),
+		sleep:    time.Sleep,
+	}
+}
+
+// Call fn until it succeeds, returns a permanent error or the attempts run out.
+func (r *retrier) do(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		re, ok := err.(*retryableError)
+		if !ok {
+			return err
+		}
+
+		if attempt >= r.attempts {
+			return fmt.Errorf("gave up after %d attempts: %v", attempt, re.err)
+		}
+
+		// Honour the delay requested by the server, if it is the longest.
+		delay := r.backoff(attempt - 1)
+		if re.after > delay {
+			delay = re.after
+		}
+
+		log.Printf("attempt %d failed, retrying in %s: %v\n", attempt, delay.Round(time.Millisecond), re.err)
+
+		r.sleep(delay)
+	}
+}
+
+// Returns an error for any response other than 200 OK. Rate limits and
+// server errors are retryable, other responses are permanent.
+func checkResponse(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return retryable(
+			fmt.Errorf("bad response from server: %s", res.Status),
+			retryAfter(res.Header.Get("Retry-After"), time.Now()),
+		)
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return retryable(fmt.Errorf("bad response from server: %s", res.Status), 0)
+	}
+
+	return fmt.Errorf("bad response from server: %s", res.Status)
+}
+
+// Parse a Retry-After header, which is either a number of seconds or a date.
+func retryAfter(val string, now time.Time) time.Duration {
+	if val == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if date, err := http.ParseTime(val); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
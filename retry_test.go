@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetrier(t *testing.T) {
+	tests := map[string]struct {
+		errs     []error
+		calls    int
+		sleeps   []time.Duration
+		expected bool
+	}{
+		"success": {
+			errs:     []error{nil},
+			calls:    1,
+			sleeps:   []time.Duration{},
+			expected: true,
+		},
+		"transient": {
+			errs:     []error{retryable(errors.New("reset"), 0), retryable(errors.New("reset"), 0), nil},
+			calls:    3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+			expected: true,
+		},
+		"retry after": {
+			errs:     []error{retryable(errors.New("429"), 30*time.Second), nil},
+			calls:    2,
+			sleeps:   []time.Duration{30 * time.Second},
+			expected: true,
+		},
+		"permanent": {
+			errs:     []error{errors.New("404"), nil},
+			calls:    1,
+			sleeps:   []time.Duration{},
+			expected: false,
+		},
+		"attempts exhausted": {
+			errs:     []error{retryable(errors.New("503"), 0), retryable(errors.New("503"), 0), retryable(errors.New("503"), 0), nil},
+			calls:    3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sleeps := []time.Duration{}
+
+			r := &retrier{
+				attempts: 3,
+				backoff:  func(retry int) time.Duration { return time.Second << uint(retry) },
+				sleep:    func(d time.Duration) { sleeps = append(sleeps, d) },
+			}
+
+			calls := 0
+			err := r.do(func() error {
+				calls++
+				return test.errs[calls-1]
+			})
+
+			if (err == nil) != test.expected {
+				t.Errorf("expected success to be %t, got %v", test.expected, err)
+			}
+
+			if calls != test.calls {
+				t.Errorf("expected %d calls, got %d", test.calls, calls)
+			}
+
+			if !reflect.DeepEqual(sleeps, test.sleeps) {
+				t.Errorf("expected sleeps %v, got %v", test.sleeps, sleeps)
+			}
+		})
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := map[string]struct {
+		status    int
+		header    string
+		retryable bool
+		after     time.Duration
+	}{
+		"ok":                  {http.StatusOK, "", false, 0},
+		"not found":           {http.StatusNotFound, "", false, 0},
+		"rate limited":        {http.StatusTooManyRequests, "", true, 0},
+		"rate limited after":  {http.StatusTooManyRequests, "120", true, 2 * time.Minute},
+		"unavailable":         {http.StatusServiceUnavailable, "5", true, 5 * time.Second},
+		"server error":        {http.StatusInternalServerError, "", true, 0},
+		"bad gateway":         {http.StatusBadGateway, "", true, 0},
+		"invalid retry after": {http.StatusTooManyRequests, "soon", true, 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: test.status,
+				Status:     http.StatusText(test.status),
+				Header:     http.Header{},
+			}
+			res.Header.Set("Retry-After", test.header)
+
+			err := checkResponse(res)
+
+			re, ok := err.(*retryableError)
+			if ok != test.retryable {
+				t.Fatalf("expected retryable to be %t, got %v", test.retryable, err)
+			}
+
+			if ok && re.after != test.after {
+				t.Errorf("expected a delay of %s, got %s", test.after, re.after)
+			}
+		})
+	}
+
+	t.Run("retry after date", func(t *testing.T) {
+		now := time.Date(2018, 9, 21, 12, 0, 0, 0, time.UTC)
+
+		if d := retryAfter("Fri, 21 Sep 2018 12:01:30 GMT", now); d != 90*time.Second {
+			t.Errorf("expected a delay of 1m30s, got %s", d)
+		}
+	})
+}
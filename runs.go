@@ -0,0 +1,381 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Maximum number of errors that is stored with a run.
+const maxRunErrors = 100
+
+// A run of an import, as recorded in import_runs. The counts are safe for
+// concurrent use, as the meetings of several hosts are upserted at once.
+type importRun struct {
+	id     int64
+	kind   string
+	source string
+	dryRun bool
+	validators
+
+	mu        sync.Mutex
+	inserted  int64
+	updated   int64
+	unchanged int64
+	skipped   int64
+	errors    []string
+	changes   []runChange
+}
+
+// A row that an import inserted, updated or deregistered, by its key.
+type runChange struct {
+	kind string
+	key  string
+}
+
+// Record the start of an import of kind from source. Runs are not recorded in
+// a dry run.
+func startRun(db *sql.DB, kind, source string, dryRun bool) (*importRun, error) {
+	run := &importRun{kind: kind, source: source, dryRun: dryRun}
+
+	if dryRun {
+		return run, nil
+	}
+
+	err := db.QueryRow(`
+		INSERT INTO import_runs (run_kind, run_source, run_started_at, run_status)
+		VALUES ($1, $2, now(), 'running')
+		RETURNING run_id`,
+		kind, source,
+	).Scan(&run.id)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// Record a row that was inserted, updated or deregistered.
+func (r *importRun) change(kind, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch kind {
+	case "inserted":
+		r.inserted++
+	case "updated":
+		r.updated++
+	}
+
+	r.changes = append(r.changes, runChange{kind, key})
+}
+
+// Count rows that were unchanged or skipped.
+func (r *importRun) count(unchanged, skipped int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unchanged += unchanged
+	r.skipped += skipped
+}
+
+// Record an error that did not stop the import, such as a skipped row.
+func (r *importRun) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.errors) < maxRunErrors {
+		r.errors = append(r.errors, err.Error())
+	}
+}
+
+// Returns the validators of the last run of kind from source that imported
+// or skipped it, or none if there is no such run.
+func lastValidators(db *sql.DB, kind, source string) (validators, error) {
+	var v validators
+
+	err := db.QueryRow(`
+		SELECT COALESCE(run_etag, ''), COALESCE(run_last_modified, ''), COALESCE(run_sha256, '')
+		FROM import_runs
+		WHERE run_kind = $1 AND run_source = $2 AND run_status IN ('succeeded', 'unchanged')
+		ORDER BY run_id DESC
+		LIMIT 1`,
+		kind, source,
+	).Scan(&v.etag, &v.lastModified, &v.sha256)
+	if err == sql.ErrNoRows {
+		return v, nil
+	}
+
+	return v, err
+}
+
+// Record the end of a run that was skipped, as the source did not change
+// since the last run.
+func (r *importRun) finishUnchanged(db *sql.DB) error {
+	if r.dryRun {
+		return nil
+	}
+
+	return r.save(db, "unchanged")
+}
+
+// Record the end of the run with its counts and changes. The run failed if
+// err is not nil, which is returned in favor of errors from the ledger.
+func (r *importRun) finish(db *sql.DB, err error) error {
+	status := "succeeded"
+
+	if err != nil {
+		status = "failed"
+		r.fail(err)
+	}
+
+	if r.dryRun {
+		return err
+	}
+
+	if ferr := r.save(db, status); ferr != nil && err == nil {
+		return ferr
+	}
+
+	return err
+}
+
+func (r *importRun) save(db *sql.DB, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Allow for a rollback if the transaction was not succesfull.
+	success := false
+
+	defer func() {
+		if !success {
+			txn.Rollback()
+		}
+	}()
+
+	_, err = txn.Exec(`
+		UPDATE import_runs SET
+			run_sha256 = NULLIF($2, ''),
+			run_etag = NULLIF($3, ''),
+			run_last_modified = NULLIF($4, ''),
+			run_finished_at = now(),
+			run_status = $5,
+			run_inserted = $6,
+			run_updated = $7,
+			run_unchanged = $8,
+			run_skipped = $9,
+			run_errors = $10
+		WHERE run_id = $1`,
+		r.id, r.sha256, r.etag, r.lastModified, status,
+		r.inserted, r.updated, r.unchanged, r.skipped, pq.Array(r.errors),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, len(r.changes))
+	for i, c := range r.changes {
+		rows[i] = []interface{}{r.id, c.kind, c.key}
+	}
+
+	if err := copyRows(txn, "import_run_changes", []string{"run_id", "change_kind", "change_key"}, rows); err != nil {
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	success = true
+
+	return nil
+}
+
+// Upsert a single row with a query that returns whether the row was inserted,
+// and no row if it was unchanged, such as:
+//
+//	INSERT ... ON CONFLICT ... DO UPDATE SET ... WHERE ... IS DISTINCT FROM ... RETURNING xmax = 0
+func upsertRow(db *sql.DB, run *importRun, key, query string, args ...interface{}) error {
+	var inserted bool
+
+	err := db.QueryRow(query, args...).Scan(&inserted)
+	if err == sql.ErrNoRows {
+		run.count(1, 0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if inserted {
+		run.change("inserted", key)
+	} else {
+		run.change("updated", key)
+	}
+
+	return nil
+}
+
+// A recorded run, as listed by the runs command.
+type runSummary struct {
+	id         int64
+	kind       string
+	source     string
+	sha256     string
+	startedAt  time.Time
+	finishedAt pq.NullTime
+	status     string
+	inserted   int64
+	updated    int64
+	unchanged  int64
+	skipped    int64
+	errors     []string
+}
+
+const runColumns = `
+	run_id, run_kind, run_source, COALESCE(run_sha256, ''), run_started_at, run_finished_at, run_status,
+	run_inserted, run_updated, run_unchanged, run_skipped, COALESCE(run_errors, '{}')
+`
+
+func scanRun(row interface{ Scan(...interface{}) error }) (runSummary, error) {
+	var r runSummary
+
+	err := row.Scan(
+		&r.id, &r.kind, &r.source, &r.sha256, &r.startedAt, &r.finishedAt, &r.status,
+		&r.inserted, &r.updated, &r.unchanged, &r.skipped, pq.Array(&r.errors),
+	)
+
+	return r, err
+}
+
+// Returns how long the run took, or how long it has been running.
+func (r runSummary) duration() time.Duration {
+	end := time.Now()
+	if r.finishedAt.Valid {
+		end = r.finishedAt.Time
+	}
+
+	return end.Sub(r.startedAt).Round(time.Second)
+}
+
+// Write the most recent runs to out, newest first.
+func listRuns(db *sql.DB, limit int, out io.Writer) error {
+	rows, err := db.Query(`SELECT `+runColumns+` FROM import_runs ORDER BY run_id DESC LIMIT $1`, limit)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tSTATUS\tSTARTED\tDURATION\tINSERTED\tUPDATED\tUNCHANGED\tSKIPPED\tERRORS\tSOURCE")
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			r.id, r.kind, r.status, r.startedAt.Format("2006-01-02 15:04"), r.duration(),
+			r.inserted, r.updated, r.unchanged, r.skipped, len(r.errors), r.source,
+		)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// Write what changed between run from and run to, which must be of the same
+// kind, to out. That is the last change to each row in the runs after from,
+// up to and including to.
+func diffRuns(db *sql.DB, from, to int64, out io.Writer) error {
+	a, err := scanRun(db.QueryRow(`SELECT `+runColumns+` FROM import_runs WHERE run_id = $1`, from))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("run %d does not exist", from)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := scanRun(db.QueryRow(`SELECT `+runColumns+` FROM import_runs WHERE run_id = $1`, to))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("run %d does not exist", to)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.kind != b.kind {
+		return fmt.Errorf("run %d imported %s and run %d imported %s", a.id, a.kind, b.id, b.kind)
+	}
+
+	if a.id >= b.id {
+		return fmt.Errorf("run %d must be older than run %d", a.id, b.id)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "\tRUN %d\tRUN %d\n", a.id, b.id)
+	fmt.Fprintf(w, "started\t%s\t%s\n", a.startedAt.Format(time.RFC3339), b.startedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "status\t%s\t%s\n", a.status, b.status)
+	fmt.Fprintf(w, "sha256\t%s\t%s\n", a.sha256, b.sha256)
+	fmt.Fprintf(w, "inserted\t%d\t%d\n", a.inserted, b.inserted)
+	fmt.Fprintf(w, "updated\t%d\t%d\n", a.updated, b.updated)
+	fmt.Fprintf(w, "unchanged\t%d\t%d\n", a.unchanged, b.unchanged)
+	fmt.Fprintf(w, "skipped\t%d\t%d\n", a.skipped, b.skipped)
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (import_run_changes.change_key) import_run_changes.change_kind, import_run_changes.change_key
+		FROM import_run_changes
+		INNER JOIN import_runs USING (run_id)
+		WHERE import_runs.run_kind = $1 AND run_id > $2 AND run_id <= $3
+		ORDER BY import_run_changes.change_key, run_id DESC`,
+		a.kind, a.id, b.id,
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	changes := map[string][]string{}
+
+	for rows.Next() {
+		var c runChange
+
+		if err := rows.Scan(&c.kind, &c.key); err != nil {
+			return err
+		}
+
+		changes[c.kind] = append(changes[c.kind], c.key)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, kind := range []string{"inserted", "updated", "deregistered"} {
+		fmt.Fprintf(out, "\n%s (%d)\n", kind, len(changes[kind]))
+
+		for _, key := range changes[kind] {
+			fmt.Fprintf(out, "  %s\n", key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestImportRunCounts(t *testing.T) {
+	run := &importRun{kind: "meetings", dryRun: true}
+
+	var wg sync.WaitGroup
+
+	// Hosts are upserted concurrently.
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			run.change("inserted", fmt.Sprint("inserted ", i))
+			run.change("updated", fmt.Sprint("updated ", i))
+			run.change("deregistered", fmt.Sprint("deregistered ", i))
+			run.count(2, 1)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < maxRunErrors+10; i++ {
+		run.fail(errors.New("skipped"))
+	}
+
+	tests := map[string]struct {
+		output   int
+		expected int
+	}{
+		"inserted":  {int(run.inserted), 4},
+		"updated":   {int(run.updated), 4},
+		"unchanged": {int(run.unchanged), 8},
+		"skipped":   {int(run.skipped), 4},
+		"changes":   {len(run.changes), 12},
+		"errors":    {len(run.errors), maxRunErrors},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.output != test.expected {
+				t.Errorf("expected %s to be %d, got %d", name, test.expected, test.output)
+			}
+		})
+	}
+
+	if err := run.finish(nil, errors.New("failed")); err == nil || err.Error() != "failed" {
+		t.Errorf("expected the error of the run to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type scrapeOptions struct {
+	host        string
+	concurrency int
+	interval    time.Duration // Minimum time between requests, across all workers.
+	maxPages    int           // Maximum pages per host ID, or 0 for no limit.
+	attempts    int           // Maximum attempts per page.
+	incremental bool          // Stop at the first page with stored meetings.
+	gazetteer   string        // Path to the gazetteer that locations are normalized with.
+	dryRun      bool
+}
+
+// A token bucket that hands out a token every interval, up to burst tokens.
+type limiter struct {
+	tokens chan struct{}
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+func newLimiter(interval time.Duration, burst int) *limiter {
+	l := &limiter{
+		tokens: make(chan struct{}, burst),
+		ticker: time.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+
+	// Start with a single token, so the first request is not delayed.
+	l.tokens <- struct{}{}
+
+	go func() {
+		for {
+			select {
+			case <-l.ticker.C:
+				select {
+				case l.tokens <- struct{}{}:
+				default:
+				}
+			case <-l.done:
+				return
+			}
+		}
+	}()
+
+	return l
+}
+
+// Block until a token is available.
+func (l *limiter) Wait() {
+	<-l.tokens
+}
+
+func (l *limiter) Stop() {
+	l.ticker.Stop()
+	close(l.done)
+}
+
+type scraper struct {
+	host     string
+	maxPages int
+	fetcher  Fetcher
+	limiter  *limiter
+	retry    *retrier
+}
+
+func newScraper(f Fetcher, opts scrapeOptions) *scraper {
+	return &scraper{
+		host:     opts.host,
+		fetcher:  f,
+		maxPages: opts.maxPages,
+		limiter:  newLimiter(opts.interval, 1),
+		retry:    newRetrier(opts.attempts),
+	}
+}
+
+func (s *scraper) Stop() {
+	s.limiter.Stop()
+}
+
+// Scrape path and each following page, applying extract to every table row.
+// After each page, onPage is called with its path and that of the next page,
+// if any. The crawl stops when onPage returns false or an error.
+func (s *scraper) scrape(extract func(int, *goquery.Selection), path string, onPage func(path, next string) (bool, error)) error {
+	for page := 1; ; page++ {
+		if s.maxPages > 0 && page > s.maxPages {
+			log.Printf("stopped before %s after the limit of %d pages\n", path, s.maxPages)
+			return nil
+		}
+
+		next, err := s.scrapePage(extract, path)
+		if err != nil {
+			return err
+		}
+
+		more, err := onPage(path, next)
+		if err != nil {
+			return err
+		}
+
+		if !more || next == "" {
+			return nil
+		}
+
+		path = next
+	}
+}
+
+// Scrape a single page and return the path of the next page, if any.
+func (s *scraper) scrapePage(extract func(int, *goquery.Selection), path string) (string, error) {
+	var doc *goquery.Document
+
+	err := s.retry.do(func() error {
+		// Wait for our turn to prevent rate limits.
+		s.limiter.Wait()
+
+		// Request document. Network errors are assumed to be transient.
+		res, err := s.fetcher.Fetch(fmt.Sprint(s.host, path), nil)
+		if err != nil {
+			return retryable(err, 0)
+		}
+
+		defer res.Body.Close()
+
+		if err := checkResponse(res); err != nil {
+			return err
+		}
+
+		// Parse response with goquery. A failure is likely a cut off body.
+		doc, err = goquery.NewDocumentFromReader(res.Body)
+		if err != nil {
+			return retryable(fmt.Errorf("failed to parse %s: %v", path, err), 0)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Iterate over table rows and extract data.
+	doc.Find("#listMeetingsTable tbody tr").Each(extract)
+
+	// Find next page href.
+	next, _ := doc.Find(".pagelinks a img[alt='Next']").Parent().Attr("href")
+
+	return next, nil
+}
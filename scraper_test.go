@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A crawlStore in memory, with the meetings and checkpoint of each host ID.
+type memStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]checkpoint
+	meetings    map[string][]meeting
+	stored      int // Returned by storedMeetings, for an incremental crawl.
+}
+
+func newMemStore() *memStore {
+	return &memStore{checkpoints: map[string]checkpoint{}, meetings: map[string][]meeting{}}
+}
+
+func (m *memStore) loadCheckpoint(hostID string) (checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp, ok := m.checkpoints[hostID]
+	if !ok {
+		cp = checkpoint{hostID: hostID}
+	}
+
+	return cp, nil
+}
+
+func (m *memStore) storedMeetings(job scrapeJob, meetings []meeting) (int, error) {
+	return m.stored, nil
+}
+
+func (m *memStore) savePage(job scrapeJob, meetings []meeting, unresolved []unresolvedMember, cp checkpoint, run *importRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The crawl reuses the slice for the next page.
+	m.meetings[job.hostID] = append(m.meetings[job.hostID], meetings...)
+	m.checkpoints[job.hostID] = cp
+
+	return nil
+}
+
+// A fetcher that records when each request was made.
+type timedFetcher struct {
+	Fetcher
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (f *timedFetcher) Fetch(url string, header http.Header) (*http.Response, error) {
+	f.mu.Lock()
+	f.times = append(f.times, time.Now())
+	f.mu.Unlock()
+
+	return f.Fetcher.Fetch(url, header)
+}
+
+// Returns the jobs of the department in database/departments, of which the
+// pages of one host ID are missing from fixtures/meetings.
+func fixtureJobs(t *testing.T) []scrapeJob {
+	data, err := ioutil.ReadFile(filepath.Join("database", "departments", "COMM.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dep department
+	if err := json.Unmarshal(data, &dep); err != nil {
+		t.Fatal(err)
+	}
+
+	members := newMemberMatcher(dep)
+
+	return []scrapeJob{
+		{dep.Leaders[0], members, dep.Leaders[0].LeaderHostID, true},
+		{dep.Leaders[0], members, dep.Leaders[0].MemberHostID, false},
+		{dep.Leaders[1], members, dep.Leaders[1].LeaderHostID, true},
+	}
+}
+
+func TestScrapeHosts(t *testing.T) {
+	interval := 20 * time.Millisecond
+
+	f := &timedFetcher{Fetcher: &fileFetcher{filepath.Join("fixtures", "meetings")}}
+
+	opts := scrapeOptions{
+		host:        meetingsURL,
+		concurrency: 3,
+		interval:    interval,
+		attempts:    1,
+	}
+
+	// The limiter ticks from when it is created.
+	start := time.Now()
+
+	s := newScraper(f, opts)
+	defer s.Stop()
+
+	jobs := fixtureJobs(t)
+	store := newMemStore()
+	run := &importRun{}
+
+	err := scrapeHosts(s, &gazetteer{}, jobs, opts, run, store)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 hosts failed") {
+		t.Errorf("expected 1 of 3 hosts to fail, got %v", err)
+	}
+
+	// Two pages of the leader, one of the members and the missing page.
+	if len(f.times) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(f.times))
+	}
+
+	// The limiter hands out a token every interval, whichever worker takes
+	// it, and the first one right away.
+	last := f.times[0]
+	for _, at := range f.times {
+		if at.After(last) {
+			last = at
+		}
+	}
+
+	if elapsed := last.Sub(start); elapsed < 3*interval {
+		t.Errorf("expected 4 requests to take at least %s, got %s", 3*interval, elapsed)
+	}
+
+	// The failing host does not drop the meetings of the others.
+	expected := map[string]int{jobs[0].hostID: 5, jobs[1].hostID: 4, jobs[2].hostID: 0}
+
+	for hostID, count := range expected {
+		if output := len(store.meetings[hostID]); output != count {
+			t.Errorf("expected %d meetings of host %s, got %d", count, hostID, output)
+		}
+	}
+
+	// Along with the rows of the fixtures that can not be parsed.
+	failed := false
+	for _, e := range run.errors {
+		failed = failed || strings.HasPrefix(e, "host "+jobs[2].hostID)
+	}
+
+	if !failed {
+		t.Errorf("expected an error for host %s, got %q", jobs[2].hostID, run.errors)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Topics in a subjects cell are separated by semicolons, line breaks or bullets.
+var topicSeparator = regexp.MustCompile(`[;\n•]|\s+-\s+`)
+
+// Phrases that precede many topics without adding to them, such as
+// "Exchange of views on" or "Subject:". Stripped repeatedly.
+var topicBoilerplate = regexp.MustCompile(`(?i)^(?:` +
+	`(?:(?:courtesy |introductory |follow-up )?meeting|discussions?|exchange(?: of views)?|debate|presentation|update|briefing|follow-up)` +
+	`\s+(?:on|about|of|regarding|concerning|with regard to)\s+` +
+	`|(?:subjects?|topics?)\s*:\s*` +
+	`)`)
+
+// Split the subjects of a meeting into normalized topics. Whitespace is
+// collapsed, boilerplate prefixes and trailing punctuation are stripped and
+// duplicates are removed, regardless of case.
+func meetingTopics(subjects string) []string {
+	topics := []string{}
+	seen := map[string]bool{}
+
+	for _, topic := range topicSeparator.Split(subjects, -1) {
+		topic = strings.Join(strings.Fields(topic), " ")
+
+		for {
+			stripped := topicBoilerplate.ReplaceAllString(topic, "")
+			if stripped == topic {
+				break
+			}
+			topic = stripped
+		}
+
+		topic = strings.Trim(topic, " .,:-")
+
+		key := strings.ToLower(topic)
+		if topic == "" || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMeetingTopics(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"single":       {"Digital Single Market", []string{"Digital Single Market"}},
+		"semicolons":   {"Artificial intelligence; Copyright reform", []string{"Artificial intelligence", "Copyright reform"}},
+		"line breaks":  {"Capital Markets Union\n  Brexit", []string{"Capital Markets Union", "Brexit"}},
+		"bullets":      {"• 5G • Roaming", []string{"5G", "Roaming"}},
+		"dashes":       {"Energy Union - Climate action", []string{"Energy Union", "Climate action"}},
+		"hyphenated":   {"Follow-up of the Paris Agreement", []string{"the Paris Agreement"}},
+		"whitespace":   {"  Future   of\tEurope ", []string{"Future of Europe"}},
+		"boilerplate":  {"Exchange of views on 5G deployment", []string{"5G deployment"}},
+		"nested":       {"Subject: Discussion on the Digital Single Market.", []string{"the Digital Single Market"}},
+		"case":         {"Meeting about Trade", []string{"Trade"}},
+		"duplicates":   {"Trade; trade;  TRADE", []string{"Trade"}},
+		"empty topics": {"Trade;; ;", []string{"Trade"}},
+		"empty":        {"", []string{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if output := meetingTopics(test.input); !reflect.DeepEqual(output, test.expected) {
+				t.Errorf("expected %q to be %q, got %q", test.input, test.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// A cabinet member name on a meeting page that could not be matched to a
+// member, with the best candidate and its score.
+type unresolvedMember struct {
+	text        string
+	candidate   string
+	candidateID string
+	score       float64
+	hostID      string
+	page        string
+}
+
+// Record unresolved member names. Names that were dismissed or resolved stay
+// that way.
+func saveUnresolved(unresolved []unresolvedMember, db *sql.DB) error {
+	for _, u := range unresolved {
+		var candidateID *string
+		if u.candidateID != "" {
+			candidateID = &u.candidateID
+		}
+
+		_, err := db.Exec(`
+			INSERT INTO unresolved_members (host_id, unresolved_text, unresolved_candidate, unresolved_candidate_id, unresolved_score, unresolved_page, unresolved_seen_at)
+			VALUES ($1, $2, $3, $4, $5, $6, now())
+			ON CONFLICT (host_id, unresolved_text) DO UPDATE SET
+				unresolved_candidate = EXCLUDED.unresolved_candidate,
+				unresolved_candidate_id = EXCLUDED.unresolved_candidate_id,
+				unresolved_score = EXCLUDED.unresolved_score,
+				unresolved_page = EXCLUDED.unresolved_page,
+				unresolved_seen_at = EXCLUDED.unresolved_seen_at`,
+			u.hostID, u.text, u.candidate, candidateID, u.score, u.page,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the unresolved member names that have not been dismissed or
+// resolved.
+func pendingUnresolved(db *sql.DB) ([]unresolvedMember, error) {
+	pending := []unresolvedMember{}
+
+	rows, err := db.Query(`
+		SELECT host_id, unresolved_text, unresolved_candidate, COALESCE(unresolved_candidate_id::TEXT, ''), unresolved_score, unresolved_page
+		FROM unresolved_members
+		WHERE NOT unresolved_dismissed AND unresolved_member_id IS NULL
+		ORDER BY host_id, unresolved_score DESC
+	`)
+	if err != nil {
+		return pending, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u unresolvedMember
+
+		if err := rows.Scan(&u.hostID, &u.text, &u.candidate, &u.candidateID, &u.score, &u.page); err != nil {
+			return pending, err
+		}
+
+		pending = append(pending, u)
+	}
+	if err := rows.Err(); err != nil {
+		return pending, err
+	}
+
+	return pending, nil
+}
+
+// Walk through each unresolved member name and ask whether to accept the
+// best candidate, match it to another member or dismiss it. Accepted names
+// are added as an alias to the member in the department JSON in dir, and the
+// member they resolve to is recorded in unresolved_members.
+func reviewMembers(dir string, db *sql.DB, in io.Reader, out io.Writer, dryRun bool) error {
+	// Members of each department, by the host ID of their meeting page.
+	hostMembers := map[string][]member{}
+
+	err := forEachDepartment(dir, func(dep department) error {
+		for _, l := range dep.Leaders {
+			if l.MemberHostID != "" {
+				hostMembers[l.MemberHostID] = dep.Members
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	pending, err := pendingUnresolved(db)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		fmt.Fprintln(out, "no unresolved members")
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+
+	ask := func(prompt string) (string, bool) {
+		fmt.Fprint(out, prompt)
+
+		if !scanner.Scan() {
+			return "", false
+		}
+
+		return strings.TrimSpace(scanner.Text()), true
+	}
+
+	for i, u := range pending {
+		fmt.Fprintf(out, "\n(%d/%d) %q on %s\n", i+1, len(pending), u.text, u.page)
+
+		if u.candidate != "" {
+			fmt.Fprintf(out, "best candidate: %q, with a score of %.2f\n", u.candidate, u.score)
+		}
+
+		answer, ok := ask("[a]ccept, [m]atch another member, [d]ismiss, [s]kip or [q]uit: ")
+		if !ok || answer == "q" {
+			return scanner.Err()
+		}
+
+		var memberID string
+
+		switch answer {
+		case "a":
+			if u.candidateID == "" {
+				fmt.Fprintln(out, "there is no candidate to accept")
+				continue
+			}
+
+			memberID = u.candidateID
+		case "m":
+			name, ok := ask("member name: ")
+			if !ok {
+				return scanner.Err()
+			}
+
+			for _, m := range hostMembers[u.hostID] {
+				if strings.EqualFold(m.Name, name) {
+					memberID = *m.ID
+				}
+			}
+
+			if memberID == "" {
+				fmt.Fprintf(out, "could not find %q among the members of host %s\n", name, u.hostID)
+				continue
+			}
+		case "d":
+			if dryRun {
+				fmt.Fprintf(out, "dry run, would dismiss %q\n", u.text)
+				continue
+			}
+
+			_, err := db.Exec(`
+				UPDATE unresolved_members SET unresolved_dismissed = TRUE
+				WHERE host_id = $1 AND unresolved_text = $2`,
+				u.hostID, u.text,
+			)
+			if err != nil {
+				return err
+			}
+
+			continue
+		default:
+			continue
+		}
+
+		if dryRun {
+			fmt.Fprintf(out, "dry run, would add alias %q to member %s\n", u.text, memberID)
+			continue
+		}
+
+		if err := addAlias(dir, memberID, u.text); err != nil {
+			return err
+		}
+
+		// The alias resolves the name on the next scrape.
+		_, err := db.Exec(`
+			UPDATE unresolved_members SET unresolved_member_id = $3
+			WHERE host_id = $1 AND unresolved_text = $2`,
+			u.hostID, u.text, memberID,
+		)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "added alias %q\n", u.text)
+	}
+
+	return nil
+}
+
+// Add an alias to a member in the department JSON files in dir.
+func addAlias(dir, memberID, alias string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+
+		dep, err := readDepartment(path)
+		if err != nil {
+			return err
+		}
+
+		for i, m := range dep.Members {
+			if m.ID == nil || *m.ID != memberID {
+				continue
+			}
+
+			for _, a := range m.Aliases {
+				if a == alias {
+					return nil
+				}
+			}
+
+			dep.Members[i].Aliases = append(dep.Members[i].Aliases, alias)
+
+			return writeDepartment(path, dep)
+		}
+	}
+
+	return fmt.Errorf("could not find member %s in %s", memberID, dir)
+}
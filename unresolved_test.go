@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAddAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "departments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(filepath.Join("database", "departments", "COMM.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "COMM.json")
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// José Eduardo Leandro
+	id := "6d54f0cc-1e97-46ed-8409-7710305b1fbd"
+
+	// Adding the same alias twice should only add it once.
+	for i := 0; i < 2; i++ {
+		if err := addAlias(dir, id, "J. E. Leandro"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dep, err := readDepartment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range dep.Members {
+		if *m.ID == id && !reflect.DeepEqual(m.Aliases, []string{"J. E. Leandro"}) {
+			t.Errorf("expected aliases to be [J. E. Leandro], got %v", m.Aliases)
+		}
+	}
+
+	if err := addAlias(dir, "00000000-0000-0000-0000-000000000000", "Nobody"); err == nil {
+		t.Error("member does not exist, but no error was returned")
+	}
+}